@@ -8,6 +8,7 @@ import (
 	"github.com/gofrs/uuid"
 
 	md "github.com/ytsiuryn/ds-audiomd"
+	afile "github.com/ytsiuryn/ds-mdreader/file"
 	srv "github.com/ytsiuryn/ds-microservice"
 )
 
@@ -15,12 +16,29 @@ import (
 type AudioReaderRequest struct {
 	Cmd  string `json:"cmd"`
 	Path string `json:"path"`
+	// Покадровая проверка целостности аудиопотока (MP3).
+	Deep bool `json:"deep,omitempty"`
 }
 
 // AudioReaderResponse описывает структуру ответа микросервиса.
 type AudioReaderResponse struct {
-	Assumption *md.Assumption     `json:"assumption,omitempty"`
-	Error      *srv.ErrorResponse `json:"error,omitempty"`
+	Assumption *md.Assumption `json:"assumption,omitempty"`
+	// Имена файлов, из которых прочитаны изображения Assumption.Pictures (по индексу).
+	PictureSources []string `json:"picture_sources,omitempty"`
+	// Результаты проверки целостности аудиопотока по именам файлов (режим Deep).
+	Integrity map[string]*afile.MP3Integrity `json:"integrity,omitempty"`
+	// Таблицы содержания дисков из CUESHEET файлов FLAC по номерам дисков.
+	TOC map[int]*afile.FlacCueSheet `json:"toc,omitempty"`
+	// Главы треков (фреймы CHAP тега ID3v2) по именам файлов.
+	Chapters map[string][]*Chapter `json:"chapters,omitempty"`
+	Warnings []string              `json:"warnings,omitempty"`
+	Error    *srv.ErrorResponse    `json:"error,omitempty"`
+}
+
+// Chapter описывает главу трека. Изображение главы указывается индексом в Assumption.Pictures.
+type Chapter struct {
+	*afile.ID3v2Chapter
+	Picture *int `json:"picture,omitempty"`
 }
 
 // Unwrap контроллирует значение ответа микросервиса, и, в случае ошибки,
@@ -0,0 +1,152 @@
+// AIFF/AIFC processing module.
+// Specification links: http://www-mmsp.ece.mcgill.ca/Documents/AudioFormats/AIFF/Docs/AIFF-1.3.pdf
+// http://www-mmsp.ece.mcgill.ca/Documents/AudioFormats/AIFF/Docs/AIFF-C.9.26.91.pdf
+
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+	intutils "github.com/ytsiuryn/go-intutils"
+)
+
+const (
+	aiffFormSign       = "FORM"
+	aiffSign           = "AIFF"
+	aifcSign           = "AIFC"
+	aifcCompressionKey = "AIFC_COMPRESSION"
+)
+
+// Public errors
+var (
+	ErrAIFFNoSign         = errors.New("has no AIFF sign mark")
+	ErrAIFFIncorrectChunk = errors.New("incorrect AIFF chunk")
+	ErrAIFFNoCommonChunk  = errors.New("has no AIFF COMM chunk")
+)
+
+// Aiff is type for AIFF/AIFC audio files processing.
+type Aiff struct {
+	*md.Track
+	release *md.Release
+	r       *binary.Reader
+}
+
+// TrackMetadata gatheres metadata info for AIFF/AIFC file
+func (aiff *Aiff) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
+	aiff.release = release
+	aiff.Track = track
+	aiff.r = binary.NewReader(f)
+	end := aiff.r.SeekBytes(0, io.SeekEnd)
+	aiff.r.SeekBytes(0, io.SeekStart)
+	data := aiff.r.ReadBytes(12)
+	if len(data) < 12 || string(data[:4]) != aiffFormSign {
+		return ErrAIFFNoSign
+	}
+	formType := string(data[8:12])
+	if formType != aiffSign && formType != aifcSign {
+		return ErrAIFFNoSign
+	}
+	var commFound bool
+	var id3Pos int64 = -1
+	textTags := make(map[TagKey]string)
+	for pos := int64(12); pos+8 <= end; {
+		ckID := string(aiff.r.ReadBytes(4))
+		ckSize := int64(aiff.r.ReadBEUint32())
+		pos += 8
+		if pos+ckSize > end {
+			return ErrAIFFIncorrectChunk
+		}
+		var err error
+		switch ckID {
+		case "COMM":
+			err = aiff.commChunk(aiff.r.ReadBytes(ckSize), formType == aifcSign)
+			commFound = true
+		case "NAME", "AUTH", "ANNO", "(c) ":
+			val := strings.TrimSpace(latin1String(bytes.TrimRight(aiff.r.ReadBytes(ckSize), "\x00")))
+			if tag := SchemaTagToUniKey[AIFFText][ckID]; tag == Comments && textTags[tag] != "" {
+				textTags[tag] += "\n" + val // ANNO chunk may be repeated
+			} else {
+				textTags[tag] = val
+			}
+		case "ID3 ", "id3 ":
+			id3Pos = pos
+		}
+		if err != nil {
+			return err
+		}
+		pos += ckSize + ckSize&1 // chunks are word aligned
+		aiff.r.SeekBytes(pos, io.SeekStart)
+	}
+	if !commFound {
+		return ErrAIFFNoCommonChunk
+	}
+	if err := ProcessTags(textTags, release, track); err != nil {
+		return err
+	}
+	if id3Pos >= 0 {
+		aiff.r.SeekBytes(id3Pos, io.SeekStart)
+		processedTags, err := ID3v2Metadata(aiff.r, aiff.Track, aiff.release)
+		if err != nil {
+			return err
+		}
+		if err = ProcessTags(processedTags, release, track); err != nil {
+			return err
+		}
+	}
+	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	return nil
+}
+
+// Common chunk: channels(2), sample frames(4), sample size(2), samplerate(10, IEEE 754
+// 80-bit extended), [AIFC: compression type(4), compression name(pstring)].
+func (aiff *Aiff) commChunk(d []byte, isAIFC bool) error {
+	if len(d) < 18 {
+		return ErrAIFFIncorrectChunk
+	}
+	aiff.AudioInfo.Channels = int(encb.BigEndian.Uint16(d[:2]))
+	sampleFrames := encb.BigEndian.Uint32(d[2:6])
+	aiff.AudioInfo.SampleSize = int(encb.BigEndian.Uint16(d[6:8]))
+	samplerate := ieee754Extended(d[8:18])
+	if samplerate <= 0 {
+		return ErrAIFFIncorrectChunk
+	}
+	aiff.AudioInfo.Samplerate = int(math.Round(samplerate))
+	aiff.Duration = intutils.Duration(math.Round(1000 * float64(sampleFrames) / samplerate))
+	aiff.AudioInfo.AvgBitrate = int(math.Round(
+		.001 * samplerate * float64(aiff.AudioInfo.Channels*aiff.AudioInfo.SampleSize)))
+	if isAIFC && len(d) >= 22 {
+		if compression := string(d[18:22]); compression != "NONE" {
+			aiff.Unprocessed[aifcCompressionKey] = compression
+			if aiff.Duration > 0 { // real bitrate depends on compression
+				aiff.AudioInfo.AvgBitrate = int(
+					math.Round(8 * float64(aiff.FileInfo.FileSize) / float64(aiff.Duration)))
+			}
+		}
+	}
+	return nil
+}
+
+// Decodes IEEE 754 80-bit extended precision number:
+// sign(1 bit), exponent(15 bits), mantissa with explicit integer bit(64 bits).
+func ieee754Extended(b []byte) float64 {
+	exp := int(encb.BigEndian.Uint16(b[:2]) & 0x7fff)
+	mantissa := encb.BigEndian.Uint64(b[2:10])
+	if exp == 0 && mantissa == 0 {
+		return 0
+	}
+	if exp == 0x7fff {
+		return math.Inf(1)
+	}
+	ret := math.Ldexp(float64(mantissa), exp-16383-63)
+	if b[0]&0x80 != 0 {
+		ret = -ret
+	}
+	return ret
+}
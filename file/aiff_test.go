@@ -0,0 +1,58 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+func aiffTestChunk(id string, data ...[]byte) []byte {
+	return testChunk(encb.BigEndian, 4, id, data...)
+}
+
+func TestIEEE754Extended(t *testing.T) {
+	for samplerate, b := range map[float64][]byte{
+		44100: {0x40, 0x0e, 0xac, 0x44, 0, 0, 0, 0, 0, 0},
+		48000: {0x40, 0x0e, 0xbb, 0x80, 0, 0, 0, 0, 0, 0},
+		96000: {0x40, 0x0f, 0xbb, 0x80, 0, 0, 0, 0, 0, 0},
+		0:     make([]byte, 10),
+	} {
+		assert.Equal(t, ieee754Extended(b), samplerate)
+	}
+}
+
+func TestAiffTrackMetadata(t *testing.T) {
+	comm := []byte{0, 2, 0, 1, 0x58, 0x88, 0, 24} // 2 channels, 88200 frames, 24 bit
+	comm = append(comm, 0x40, 0x0e, 0xac, 0x44, 0, 0, 0, 0, 0, 0)
+	comm = append(comm, "NONE"...)
+	comm = append(comm, 0, 0)
+	var d []byte
+	d = append(d, aifcSign...)
+	d = append(d, aiffTestChunk("COMM", comm)...)
+	d = append(d, aiffTestChunk("NAME", []byte("test_track_title"))...)
+	d = append(d, aiffTestChunk("ANNO", []byte("first"))...)
+	d = append(d, aiffTestChunk("ANNO", []byte("second"))...)
+	d = append(d, aiffTestChunk("SSND", make([]byte, 100))...)
+	d = append(d, aiffTestChunk("ID3 ", id3v2TestTag([2]string{"TRCK", "\x003/10"}))...)
+	d = aiffTestChunk(aiffFormSign, d)
+
+	r := md.NewRelease()
+	tr := md.NewTrack()
+	require.NoError(t, new(Aiff).TrackMetadata(bytes.NewReader(d), r, tr))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 44100)
+	assert.Equal(t, tr.AudioInfo.SampleSize, 24)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, int64(tr.Duration), int64(2000))
+	assert.Equal(t, tr.AudioInfo.AvgBitrate, 2117)
+	assert.Equal(t, tr.Title, "test_track_title")
+	assert.Equal(t, tr.Notes, "first\nsecond")
+	assert.Equal(t, tr.Position, "03")
+
+	assert.ErrorIs(t, new(Aiff).TrackMetadata(
+		bytes.NewReader(aiffTestChunk(aiffFormSign, []byte(aiffSign))), r, md.NewTrack()),
+		ErrAIFFNoCommonChunk)
+}
@@ -0,0 +1,181 @@
+// Monkey's Audio processing module.
+// Specification link: https://wiki.hydrogenaud.io/index.php?title=APE_key
+// Header layouts are taken from MAC SDK (MACLib/APEHeader.h).
+
+package file
+
+import (
+	encb "encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+	intutils "github.com/ytsiuryn/go-intutils"
+)
+
+const (
+	apeSign = "MAC "
+	// Since this version the descriptor precedes the header.
+	apeNewLayoutVersion    = 3980
+	apeCompressionLevelKey = "APE_COMPRESSION_LEVEL"
+	apeFormatFlag8Bit      = 0x1
+	apeFormatFlag24Bit     = 0x8
+)
+
+// Public errors
+var (
+	ErrAPENoSign          = errors.New("has no Monkey's Audio sign mark")
+	ErrAPEIncorrectHeader = errors.New("incorrect Monkey's Audio header")
+)
+
+// APECompressionLevels describes the compression level names.
+var APECompressionLevels = map[uint16]string{
+	1000: "fast",
+	2000: "normal",
+	3000: "high",
+	4000: "extra high",
+	5000: "insane",
+}
+
+type apeDescriptor struct {
+	ID                    [4]byte // "MAC "
+	Version               uint16
+	Padding               uint16
+	DescriptorBytes       uint32
+	HeaderBytes           uint32
+	SeekTableBytes        uint32
+	HeaderDataBytes       uint32
+	APEFrameDataBytes     uint32
+	APEFrameDataBytesHigh uint32
+	TerminatingDataBytes  uint32
+	FileMD5               [16]byte
+}
+
+type apeHeader struct {
+	CompressionLevel uint16
+	FormatFlags      uint16
+	BlocksPerFrame   uint32
+	FinalFrameBlocks uint32
+	TotalFrames      uint32
+	BitsPerSample    uint16
+	Channels         uint16
+	SampleRate       uint32
+}
+
+type apeHeaderOld struct {
+	ID               [4]byte // "MAC "
+	Version          uint16
+	CompressionLevel uint16
+	FormatFlags      uint16
+	Channels         uint16
+	SampleRate       uint32
+	HeaderBytes      uint32
+	TerminatingBytes uint32
+	TotalFrames      uint32
+	FinalFrameBlocks uint32
+}
+
+// Ape is type for Monkey's Audio files processing.
+type Ape struct {
+	*md.Track
+	release *md.Release
+	r       *binary.Reader
+}
+
+// TrackMetadata gatheres metadata info for Monkey's Audio file
+func (ape *Ape) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
+	ape.release = release
+	ape.Track = track
+	ape.r = binary.NewReader(f)
+	var id3v2Tags map[TagKey]string
+	if ID3v2CheckSign(ape.r) {
+		var err error
+		if id3v2Tags, err = ID3v2Metadata(ape.r, ape.Track, ape.release); err != nil {
+			return err
+		}
+	}
+	if err := ape.readAudioProps(); err != nil {
+		return err
+	}
+	processedTags, err := mergeTrailingTags(ape.r, ape.Track, ape.release, id3v2Tags)
+	if err != nil {
+		return err
+	}
+	if err = ProcessTags(processedTags, release, track); err != nil {
+		return err
+	}
+	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	return nil
+}
+
+func (ape *Ape) readAudioProps() error {
+	start := ape.r.Position()
+	if string(ape.r.CheckBytes(4)) != apeSign {
+		return ErrAPENoSign
+	}
+	ape.r.SkipBytes(4)
+	version := ape.r.ReadLEUint16()
+	ape.r.SeekBytes(start, io.SeekStart)
+	var header apeHeader
+	if version >= apeNewLayoutVersion {
+		descriptor := apeDescriptor{}
+		ape.r.ReadInto(int64(encb.Size(descriptor)), encb.LittleEndian, &descriptor)
+		ape.r.SeekBytes(start+int64(descriptor.DescriptorBytes), io.SeekStart)
+		ape.r.ReadInto(int64(encb.Size(header)), encb.LittleEndian, &header)
+	} else {
+		oldHeader := apeHeaderOld{}
+		ape.r.ReadInto(int64(encb.Size(oldHeader)), encb.LittleEndian, &oldHeader)
+		header = apeHeader{
+			CompressionLevel: oldHeader.CompressionLevel,
+			FormatFlags:      oldHeader.FormatFlags,
+			BlocksPerFrame:   apeOldBlocksPerFrame(version, oldHeader.CompressionLevel),
+			FinalFrameBlocks: oldHeader.FinalFrameBlocks,
+			TotalFrames:      oldHeader.TotalFrames,
+			BitsPerSample:    16,
+			Channels:         oldHeader.Channels,
+			SampleRate:       oldHeader.SampleRate,
+		}
+		switch {
+		case oldHeader.FormatFlags&apeFormatFlag8Bit != 0:
+			header.BitsPerSample = 8
+		case oldHeader.FormatFlags&apeFormatFlag24Bit != 0:
+			header.BitsPerSample = 24
+		}
+	}
+	if header.SampleRate == 0 {
+		return ErrAPEIncorrectHeader
+	}
+	ape.AudioInfo.Samplerate = int(header.SampleRate)
+	ape.AudioInfo.Channels = int(header.Channels)
+	ape.AudioInfo.SampleSize = int(header.BitsPerSample)
+	var totalBlocks int64
+	if header.TotalFrames > 0 {
+		totalBlocks = int64(header.TotalFrames-1)*int64(header.BlocksPerFrame) +
+			int64(header.FinalFrameBlocks)
+	}
+	ape.Duration = intutils.Duration(math.Round(
+		1000 * float64(totalBlocks) / float64(header.SampleRate)))
+	if ape.Duration > 0 {
+		ape.AudioInfo.AvgBitrate = int(
+			math.Round(8 * float64(ape.FileInfo.FileSize) / float64(ape.Duration)))
+	}
+	if level, ok := APECompressionLevels[header.CompressionLevel]; ok {
+		ape.Unprocessed[apeCompressionLevelKey] = level
+	} else {
+		ape.Unprocessed[apeCompressionLevelKey] = strconv.Itoa(int(header.CompressionLevel))
+	}
+	return nil
+}
+
+func apeOldBlocksPerFrame(version, compressionLevel uint16) uint32 {
+	switch {
+	case version >= 3950:
+		return 73728 * 4
+	case version >= 3900 || (version >= 3800 && compressionLevel == 4000):
+		return 73728
+	}
+	return 9216
+}
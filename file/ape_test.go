@@ -0,0 +1,80 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+// Формирует тег APEv2 (только footer) с элементами "KEY=value".
+func apev2TestTag(items ...[2]string) []byte {
+	data := new(bytes.Buffer)
+	for _, item := range items {
+		encb.Write(data, encb.LittleEndian, uint32(len(item[1])))
+		encb.Write(data, encb.LittleEndian, uint32(0))
+		data.WriteString(item[0])
+		data.WriteByte(0)
+		data.WriteString(item[1])
+	}
+	footer := apeTagsHeader{
+		Preamble:  apeMetadataSign,
+		Version:   2000,
+		TagSize:   uint32(data.Len() + 32),
+		ItemCount: uint32(len(items)),
+	}
+	encb.Write(data, encb.LittleEndian, &footer)
+	return data.Bytes()
+}
+
+func TestApeTrackMetadata(t *testing.T) {
+	buf := new(bytes.Buffer)
+	encb.Write(buf, encb.LittleEndian, &apeDescriptor{
+		ID: [4]byte{'M', 'A', 'C', ' '}, Version: 3990, DescriptorBytes: 52, HeaderBytes: 24})
+	encb.Write(buf, encb.LittleEndian, &apeHeader{
+		CompressionLevel: 2000,
+		BlocksPerFrame:   73728 * 4,
+		FinalFrameBlocks: 4 * 44100,
+		TotalFrames:      1,
+		BitsPerSample:    24,
+		Channels:         2,
+		SampleRate:       44100,
+	})
+	buf.Write(make([]byte, 100))
+	buf.Write(apev2TestTag([2]string{"Title", "test_track_title"}, [2]string{"Track", "3/10"}))
+
+	r := md.NewRelease()
+	tr := md.NewTrack()
+	tr.FileInfo.FileSize = int64(buf.Len())
+	require.NoError(t, new(Ape).TrackMetadata(bytes.NewReader(buf.Bytes()), r, tr))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 44100)
+	assert.Equal(t, tr.AudioInfo.SampleSize, 24)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, int64(tr.Duration), int64(4000))
+	assert.Equal(t, tr.Unprocessed[apeCompressionLevelKey], "normal")
+	assert.Equal(t, tr.Title, "test_track_title")
+	assert.Equal(t, r.TotalTracks, 10)
+}
+
+func TestApeOldHeader(t *testing.T) {
+	buf := new(bytes.Buffer)
+	encb.Write(buf, encb.LittleEndian, &apeHeaderOld{
+		ID:               [4]byte{'M', 'A', 'C', ' '},
+		Version:          3930,
+		CompressionLevel: 5000,
+		FormatFlags:      apeFormatFlag8Bit,
+		Channels:         1,
+		SampleRate:       22050,
+		TotalFrames:      3,
+		FinalFrameBlocks: 22050,
+	})
+	tr := md.NewTrack()
+	require.NoError(t, new(Ape).TrackMetadata(bytes.NewReader(buf.Bytes()), md.NewRelease(), tr))
+	assert.Equal(t, tr.AudioInfo.SampleSize, 8)
+	assert.Equal(t, tr.AudioInfo.Channels, 1)
+	assert.Equal(t, int64(tr.Duration), int64(1000*(2*73728+22050)/22050))
+	assert.Equal(t, tr.Unprocessed[apeCompressionLevelKey], "insane")
+}
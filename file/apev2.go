@@ -1,6 +1,7 @@
 package file
 
 import (
+	"bytes"
 	encb "encoding/binary"
 	"errors"
 	"io"
@@ -8,13 +9,34 @@ import (
 
 	md "github.com/ytsiuryn/ds-audiomd"
 	binary "github.com/ytsiuryn/go-binary"
-	collection "github.com/ytsiuryn/go-collection"
 )
 
-var (
-	apeMetadataSign = [8]byte{'A', 'P', 'E', 'T', 'A', 'G', 'E', 'X'}
-	pictureTags     = []string{"COVER ART (FRONT)", "COVER ART (BACK)"}
-)
+var apeMetadataSign = [8]byte{'A', 'P', 'E', 'T', 'A', 'G', 'E', 'X'}
+
+// Binary picture items and their types.
+var pictureTags = map[string]md.PictType{
+	"COVER ART (OTHER)":              0,
+	"COVER ART (PNG ICON)":           md.PictTypePNGIcon,
+	"COVER ART (ICON)":               md.PictTypeOtherIcon,
+	"COVER ART (FRONT)":              md.PictTypeCoverFront,
+	"COVER ART (BACK)":               md.PictTypeCoverBack,
+	"COVER ART (LEAFLET)":            md.PictTypeLeaflet,
+	"COVER ART (MEDIA)":              md.PictTypeMedia,
+	"COVER ART (LEAD ARTIST)":        md.PictTypeLadArtist,
+	"COVER ART (ARTIST)":             md.PictTypeArtist,
+	"COVER ART (CONDUCTOR)":          md.PictTypeConductor,
+	"COVER ART (BAND)":               md.PictTypeOrchestra,
+	"COVER ART (COMPOSER)":           md.PictTypeComposer,
+	"COVER ART (LYRICIST)":           md.PictTypeLyricist,
+	"COVER ART (RECORDING LOCATION)": md.PictTypeRecordingLocation,
+	"COVER ART (DURING RECORDING)":   md.PictTypeDuringRecording,
+	"COVER ART (DURING PERFORMANCE)": md.PictTypeDuringPerformance,
+	"COVER ART (VIDEO CAPTURE)":      md.PictTypeMovieScreen,
+	"COVER ART (FISH)":               md.PictTypeBrightColorFish,
+	"COVER ART (ILLUSTRATION)":       md.PictTypeIllustration,
+	"COVER ART (BAND LOGOTYPE)":      md.PictTypeArtistLogotype,
+	"COVER ART (PUBLISHER LOGOTYPE)": md.PictTypePublisherLogotype,
+}
 
 var (
 	errApev2NotFound = errors.New("has no APEv2 metadata sign mark")
@@ -50,11 +72,23 @@ type apeTagsHeader struct {
 
 // APEv2Metadata чтение и парсинг блока метаданных.
 func APEv2Metadata(r *binary.Reader, track *md.Track, release *md.Release) error {
+	m, err := apev2Tags(r, track, release)
+	if err != nil {
+		return err
+	}
+	if err := ProcessTags(m, release, track); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Чтение блока метаданных без обработки тегов.
+func apev2Tags(r *binary.Reader, track *md.Track, release *md.Release) (map[TagKey]string, error) {
 	header := apeTagsHeader{}
 	headerSize := int64(encb.Size(header))
-	pos := r.SeekBytes(-headerSize, io.SeekEnd)
+	pos := r.SeekBytes(-headerSize-id3v1TrailerSize(r), io.SeekEnd)
 	if r.ReadInto(headerSize, encb.LittleEndian, &header); header.Preamble != apeMetadataSign {
-		return errApev2NotFound
+		return nil, errApev2NotFound
 	}
 	pos += (-int64(header.TagSize) + headerSize)
 	r.SeekBytes(pos, io.SeekStart)
@@ -66,7 +100,7 @@ func APEv2Metadata(r *binary.Reader, track *md.Track, release *md.Release) error
 		r.SkipBytes(4) // flags
 		tagName = strings.ToUpper(r.ReadString())
 		if apev2IsCoverTag(tagName) {
-			apev2PictMetadata(r, itemLen, release)
+			apev2PictMetadata(r.ReadBytes(itemLen), pictureTags[tagName], release)
 		} else {
 			tagVal = string(r.ReadBytes(itemLen))
 			if tag, ok := SchemaTagToUniKey[APEv2][tagName]; ok {
@@ -76,23 +110,38 @@ func APEv2Metadata(r *binary.Reader, track *md.Track, release *md.Release) error
 			}
 		}
 	}
-	if err := ProcessTags(m, release, track); err != nil {
-		return err
+	return m, nil
+}
+
+// Читает завершающие теги APEv2 и ID3v1 и объединяет их с тегами ID3v2 в начале файла.
+// Приоритет значений: APEv2, ID3v2, ID3v1.
+func mergeTrailingTags(r *binary.Reader, track *md.Track, release *md.Release,
+	id3v2Tags map[TagKey]string) (map[TagKey]string, error) {
+	apeTags, err := apev2Tags(r, track, release)
+	if err != nil && err != errApev2NotFound {
+		return nil, err
 	}
-	return nil
+	id3v1Tags, err := ID3v1Metadata(r, track)
+	if err != nil && err != errID3v1NotFound {
+		return nil, err
+	}
+	return mergeTags(id3v1Tags, id3v2Tags, apeTags), nil
 }
 
 func apev2IsCoverTag(tagName string) bool {
-	return collection.ContainsStr(tagName, pictureTags)
+	_, ok := pictureTags[tagName]
+	return ok
 }
 
-func apev2PictMetadata(r *binary.Reader, nbytes int64, release *md.Release) {
-	if release.Cover() != nil {
-		r.SkipBytes(nbytes)
-		return
+// Binary picture item: file name (description), zero byte, image data.
+func apev2PictMetadata(d []byte, pictType md.PictType, release *md.Release) {
+	picture := md.PictureInAudio{PictureMetadata: &md.PictureMetadata{}, PictType: pictType}
+	if i := bytes.IndexByte(d, 0); i != -1 {
+		picture.Notes = string(d[:i])
+		d = d[i+1:]
 	}
-	data := r.ReadBytes(nbytes)
-	picture := md.PictureInAudio{PictureMetadata: &md.PictureMetadata{}}
-	picture.Data = data
-	release.Pictures = append(release.Pictures, &picture)
+	picture.MimeType = pictureMimeType(d)
+	picture.Size = uint32(len(d))
+	picture.Data = append([]byte{}, d...)
+	addPicture(release, &picture)
 }
@@ -3,7 +3,9 @@ package file
 import (
 	"io"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"unicode/utf8"
 
 	// 	"regexp"
 	// 	"strconv"
@@ -22,16 +24,49 @@ type TrackMetadataReader interface {
 
 // InfoLoaders определяет соответствие расширения аудиофайла обработчику.
 var InfoLoaders = map[string]TrackMetadataReader{
+	".aif":  new(Aiff),
+	".aifc": new(Aiff),
+	".aiff": new(Aiff),
+	".ape":  new(Ape),
+	".dff":  new(Dff),
 	".dsf":  new(Dsf),
 	".flac": new(Flac),
+	".m4a":  new(Mp4),
+	".m4b":  new(Mp4),
+	".mka":  new(Mka),
+	".mp4":  new(Mp4),
 	".wv":   new(Wv),
 	".mp3":  new(Mp3),
+	".mpc":  new(Mpc),
+	".ogg":  new(Ogg),
+	".opus": new(Opus),
+	".tta":  new(Tta),
+	".wav":  new(Wav),
+	".webm": new(Mka),
 }
 
-// Reader returns TrackMetadataReader of the appropriate type or nil.
+// Reader returns new TrackMetadataReader of the appropriate type or nil.
 func Reader(fn string) TrackMetadataReader {
-	if cls, ok := InfoLoaders[filepath.Ext(strings.ToLower(fn))]; ok {
-		return cls
+	return newReader(filepath.Ext(strings.ToLower(fn)))
+}
+
+// Creates the reader of the InfoLoaders type for the extension or returns nil.
+// Readers keep the state of the processed file, so every file is read by a new instance.
+func newReader(ext string) TrackMetadataReader {
+	if cls, ok := InfoLoaders[ext]; ok {
+		return reflect.New(reflect.TypeOf(cls).Elem()).Interface().(TrackMetadataReader)
 	}
 	return nil
 }
+
+// Строки ISO-8859-1 (Latin-1) преобразуются в UTF-8, корректные UTF-8 строки не меняются.
+func latin1String(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
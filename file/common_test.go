@@ -0,0 +1,24 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+)
+
+// Формирует блок данных RIFF, AIFF или DSDIFF: идентификатор, размер содержимого длиной
+// sizeLen байт (4 или 8) в порядке байтов order и содержимое, выровненное по четной границе.
+func testChunk(order encb.ByteOrder, sizeLen int, id string, data ...[]byte) []byte {
+	content := bytes.Join(data, nil)
+	chunk := make([]byte, len(id)+sizeLen, len(id)+sizeLen+len(content)+1)
+	copy(chunk, id)
+	if sizeLen == 8 {
+		order.PutUint64(chunk[len(id):], uint64(len(content)))
+	} else {
+		order.PutUint32(chunk[len(id):], uint32(len(content)))
+	}
+	chunk = append(chunk, content...)
+	if len(content)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
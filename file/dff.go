@@ -0,0 +1,199 @@
+// DSDIFF-files processing module.
+// Specification link: https://dsd-guide.com/sites/default/files/white-papers/DSDIFF_1.5_Spec.pdf
+
+package file
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strings"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+	intutils "github.com/ytsiuryn/go-intutils"
+)
+
+// DSDIFF Sign marks
+const (
+	DFFSign     = "FRM8"
+	DFFFormType = "DSD "
+	DFFPropType = "SND "
+)
+
+const dffCompressionKey = "DSDIFF_COMPRESSION"
+
+// Public errors.
+var (
+	ErrDFFNoSignMark       = errors.New("DSDIFF has no sign mark")
+	ErrIncorrectDFFChunk   = errors.New("incorrect DSDIFF chunk")
+	ErrDFFNoPropertyChunk  = errors.New("DSDIFF has no PROP chunk")
+	ErrDFFIncorrectFSChunk = errors.New("incorrect DSDIFF samplerate")
+)
+
+// Dff is type for DSDIFF audio files processing.
+type Dff struct {
+	*md.Track
+	release     *md.Release
+	r           *binary.Reader
+	compression string
+	// DSD sound data size in bytes or DST frames count with frame rate
+	dsdSize      int64
+	dstFrames    uint32
+	dstFrameRate uint16
+}
+
+// TrackMetadata читает метаданные трек-файла DSDIFF.
+func (dff *Dff) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
+	dff.release = release
+	dff.Track = track
+	dff.r = binary.NewReader(f)
+	dff.compression, dff.dsdSize, dff.dstFrames, dff.dstFrameRate = "", 0, 0, 0
+	end := dff.r.SeekBytes(0, io.SeekEnd)
+	dff.r.SeekBytes(0, io.SeekStart)
+	data := dff.r.ReadBytes(16)
+	if len(data) < 16 || string(data[:4]) != DFFSign || string(data[12:16]) != DFFFormType {
+		return ErrDFFNoSignMark
+	}
+	var propFound bool
+	var id3Pos int64 = -1
+	diinTags := make(map[TagKey]string)
+	err := dff.chunks(16, end, func(ckID string, pos, size int64) error {
+		switch ckID {
+		case "PROP":
+			propFound = true
+			return dff.propChunk(pos, size)
+		case "DSD ":
+			dff.dsdSize = size
+		case "DST ":
+			return dff.dstChunk(pos, size)
+		case "DIIN":
+			return dff.diinChunk(pos, size, diinTags)
+		case "ID3 ":
+			id3Pos = pos
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !propFound {
+		return ErrDFFNoPropertyChunk
+	}
+	dff.setDuration()
+	if err = ProcessTags(diinTags, release, track); err != nil {
+		return err
+	}
+	if id3Pos >= 0 {
+		dff.r.SeekBytes(id3Pos, io.SeekStart)
+		processedTags, err := ID3v2Metadata(dff.r, dff.Track, dff.release)
+		if err != nil {
+			return err
+		}
+		if err = ProcessTags(processedTags, release, track); err != nil {
+			return err
+		}
+	}
+	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	return nil
+}
+
+// Iterates local chunks: ID(4), data size(8), data padded to even size.
+func (dff *Dff) chunks(pos, end int64, handler func(ckID string, pos, size int64) error) error {
+	for pos+12 <= end {
+		dff.r.SeekBytes(pos, io.SeekStart)
+		ckID := string(dff.r.ReadBytes(4))
+		size := int64(dff.r.ReadBEUint64())
+		pos += 12
+		if size < 0 || pos+size > end {
+			return ErrIncorrectDFFChunk
+		}
+		if err := handler(ckID, pos, size); err != nil {
+			return err
+		}
+		pos += size + size&1
+	}
+	return nil
+}
+
+// Property chunk: property type "SND "(4), local chunks FS, CHNL, CMPR, ABSS, LSCO.
+func (dff *Dff) propChunk(pos, size int64) error {
+	if size < 4 || string(dff.r.ReadBytes(4)) != DFFPropType {
+		return ErrIncorrectDFFChunk
+	}
+	return dff.chunks(pos+4, pos+size, func(ckID string, pos, size int64) error {
+		switch ckID {
+		case "FS  ":
+			if size < 4 {
+				return ErrDFFIncorrectFSChunk
+			}
+			dff.AudioInfo.Samplerate = int(dff.r.ReadBEUint32())
+		case "CHNL":
+			if size < 2 {
+				return ErrIncorrectDFFChunk
+			}
+			dff.AudioInfo.Channels = int(dff.r.ReadBEUint16())
+		case "CMPR":
+			if size < 4 {
+				return ErrIncorrectDFFChunk
+			}
+			dff.compression = strings.TrimSpace(string(dff.r.ReadBytes(4)))
+			dff.Unprocessed[dffCompressionKey] = dff.compression
+		}
+		return nil
+	})
+}
+
+// DST sound data chunk: FRTE chunk with frames count(4) and frame rate(2), DST frames.
+func (dff *Dff) dstChunk(pos, size int64) error {
+	return dff.chunks(pos, pos+size, func(ckID string, pos, size int64) error {
+		if ckID == "FRTE" {
+			if size < 6 {
+				return ErrIncorrectDFFChunk
+			}
+			dff.dstFrames = dff.r.ReadBEUint32()
+			dff.dstFrameRate = dff.r.ReadBEUint16()
+		}
+		return nil
+	})
+}
+
+// Edited master information chunk: EMID, MARK, DIAR, DITI local chunks.
+func (dff *Dff) diinChunk(pos, size int64, tags map[TagKey]string) error {
+	return dff.chunks(pos, pos+size, func(ckID string, pos, size int64) error {
+		switch ckID {
+		case "EMID":
+			dff.Unprocessed["DIIN:EMID"] = string(dff.r.ReadBytes(size))
+		case "DIAR", "DITI": // count(4), text
+			if size < 4 {
+				return ErrIncorrectDFFChunk
+			}
+			n := int64(dff.r.ReadBEUint32())
+			if n > size-4 {
+				return ErrIncorrectDFFChunk
+			}
+			val := strings.TrimSpace(latin1String(dff.r.ReadBytes(n)))
+			if ckID == "DIAR" {
+				tags[TrackArtist] = val
+			} else {
+				tags[TrackTitle] = val
+			}
+		}
+		return nil
+	})
+}
+
+func (dff *Dff) setDuration() {
+	dff.AudioInfo.SampleSize = 1
+	switch {
+	case dff.compression == "DST" && dff.dstFrameRate != 0:
+		dff.Duration = intutils.Duration(1000 * int64(dff.dstFrames) / int64(dff.dstFrameRate))
+	case dff.AudioInfo.Samplerate != 0 && dff.AudioInfo.Channels != 0:
+		sampleCount := 8 * dff.dsdSize / int64(dff.AudioInfo.Channels)
+		dff.Duration = intutils.Duration(sampleCount * 1000 / int64(dff.AudioInfo.Samplerate))
+	}
+	if dff.Duration > 0 {
+		dff.AudioInfo.AvgBitrate = int(
+			math.Round(8 * float64(dff.FileInfo.FileSize) / float64(dff.Duration)))
+	}
+}
@@ -0,0 +1,61 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+func dffTestChunk(id string, data ...[]byte) []byte {
+	return testChunk(encb.BigEndian, 8, id, data...)
+}
+
+func TestDffTrackMetadata(t *testing.T) {
+	prop := dffTestChunk("PROP", []byte(DFFPropType),
+		dffTestChunk("FS  ", []byte{0, 0x2b, 0x11, 0}), // 2822400
+		dffTestChunk("CHNL", []byte{0, 2}, []byte("SLFTSRGT")),
+		dffTestChunk("CMPR", []byte("DSD "), []byte{14}, []byte("not compressed")))
+	diin := dffTestChunk("DIIN",
+		dffTestChunk("DIAR", []byte{0, 0, 0, 17}, []byte("test_track_artist")),
+		dffTestChunk("DITI", []byte{0, 0, 0, 10}, []byte("diin_title")))
+	id3 := dffTestChunk("ID3 ", id3v2TestTag([2]string{"TIT2", "\x00test_track_title"}))
+	d := dffTestChunk(DFFSign, []byte(DFFFormType),
+		dffTestChunk("FVER", []byte{1, 5, 0, 0}),
+		prop,
+		diin,
+		dffTestChunk("DSD ", make([]byte, 2822400*2/8/2)),
+		id3)
+
+	r := md.NewRelease()
+	tr := md.NewTrack()
+	tr.FileInfo.FileSize = int64(len(d))
+	require.NoError(t, new(Dff).TrackMetadata(bytes.NewReader(d), r, tr))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 2822400)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, tr.AudioInfo.SampleSize, 1)
+	assert.Equal(t, int64(tr.Duration), int64(500))
+	assert.Equal(t, tr.Unprocessed[dffCompressionKey], "DSD")
+	assert.Equal(t, tr.Record.Actors.First(), "test_track_artist")
+	assert.Equal(t, tr.Title, "test_track_title")
+}
+
+func TestDffDST(t *testing.T) {
+	prop := dffTestChunk("PROP", []byte(DFFPropType),
+		dffTestChunk("FS  ", []byte{0, 0x2b, 0x11, 0}),
+		dffTestChunk("CHNL", []byte{0, 2}, []byte("SLFTSRGT")),
+		dffTestChunk("CMPR", []byte("DST "), []byte{11}, []byte("DST Encoded")))
+	dst := dffTestChunk("DST ", dffTestChunk("FRTE", []byte{0, 0, 0, 150, 0, 75}))
+	d := dffTestChunk(DFFSign, []byte(DFFFormType), prop, dst)
+
+	tr := md.NewTrack()
+	require.NoError(t, new(Dff).TrackMetadata(bytes.NewReader(d), md.NewRelease(), tr))
+	assert.Equal(t, tr.Unprocessed[dffCompressionKey], "DST")
+	assert.Equal(t, int64(tr.Duration), int64(2000))
+
+	assert.ErrorIs(t, new(Dff).TrackMetadata(bytes.NewReader(make([]byte, 16)),
+		md.NewRelease(), md.NewTrack()), ErrDFFNoSignMark)
+}
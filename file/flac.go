@@ -30,8 +30,9 @@ const (
 var (
 	ErrFLACNoSign                    = errors.New("has no FLAC sign mark")
 	ErrFLACInfoblockSize             = errors.New("incorrect streamInfoBlock section size")
-	ErrFLACIncorrectVorbisComment    = errors.New("vorbis comment has illegal structure")
+	ErrFLACIncorrectVorbisComment    = ErrIncorrectVorbisComment
 	ErrFLACIncorrectPictureblockSize = errors.New("incorrect mdBlockPicture size")
+	ErrFLACIncorrectCueSheet         = errors.New("incorrect mdBlockCueSheet data")
 )
 
 // Flac is type for FLAC audio files processing.
@@ -39,6 +40,10 @@ type Flac struct {
 	*md.Track
 	release *md.Release
 	r       *binary.Reader
+	// Table of contents of the disc image.
+	CueSheet *FlacCueSheet
+	// Problems of the file which do not prevent reading of the track metadata.
+	Warnings []string
 }
 
 // TrackMetadata gatheres Metadata info for Flac file
@@ -46,6 +51,8 @@ func (flac *Flac) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.
 	flac.release = release
 	flac.Track = track
 	flac.r = binary.NewReader(f)
+	flac.CueSheet = nil
+	flac.Warnings = nil
 	if ID3v2CheckSign(flac.r) {
 		tagsToProcess, err := ID3v2Metadata(flac.r, flac.Track, flac.release)
 		if err != nil {
@@ -62,6 +69,9 @@ func (flac *Flac) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.
 		return err
 	}
 	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	if flac.CueSheet != nil {
+		flac.CueSheet.apply(release, track.Disc())
+	}
 	return nil
 }
 
@@ -120,56 +130,52 @@ func (flac *Flac) mdBlockStreamInfo(blDataLen int64) error {
 
 // Vorbis metadata processing
 func (flac *Flac) mdBlockVorbisComment(blDataLen int64) (map[TagKey]string, error) {
-	var frameID, val string
-	processedTags := make(map[TagKey]string)
-	d := flac.r.ReadBytes(blDataLen)
-	x := encb.LittleEndian.Uint32(d[:4])
-	pos := x + 4 // skip LibData
-	fldCounter := encb.LittleEndian.Uint32(d[pos : pos+4])
-	pos += 4
-	for fldCounter > 0 {
-		x = encb.LittleEndian.Uint32(d[pos : pos+4])
-		pos += 4
-		fldData := d[pos : pos+x]
-		fields := strings.SplitN(string(fldData), "=", 2)
-		if len(fields) != 2 {
-			return nil, ErrFLACIncorrectVorbisComment
-		}
-		frameID = strings.ToUpper(fields[0])
-		val = strings.TrimSpace(fields[1])
-		if tag, ok := SchemaTagToUniKey[VorbisComment][frameID]; ok {
-			processedTags[tag] = val
-		} else {
-			flac.Unprocessed[frameID] = val
-		}
-		fldCounter--
-		pos += x
-	}
-	return processedTags, nil
+	return VorbisCommentMetadata(flac.r.ReadBytes(blDataLen), flac.Track, flac.release)
 }
 
-// for CD-DA track ISRC extraction
+// Cue sheet processing. The cue sheet of a single track (the track and lead-out) provides
+// ISRC of the track only. The disc image cue sheet is attached to the disc after all blocks
+// are read because the disc number is known from the tags only.
+// Malformed cue sheet is skipped with the warning.
 func (flac *Flac) mdBlockCueSheet(blDataLen int64) error {
-	flac.r.SkipBytes(9) // Track offset in samples, Track number
-	flac.Track.SetISRC(string(flac.r.ReadBytes(12)))
-	flac.r.SkipBytes(15) // other fields
+	cs, err := flacCueSheet(flac.r.ReadBytes(blDataLen))
+	if err != nil {
+		flac.Warnings = append(flac.Warnings, err.Error())
+		return nil
+	}
+	if len(cs.Tracks) == 2 {
+		if cs.Tracks[0].ISRC != "" {
+			flac.Track.SetISRC(cs.Tracks[0].ISRC)
+		}
+		return nil
+	}
+	flac.CueSheet = cs
 	return nil
 }
 
-// Cover picture data processing
+// Picture data processing
 func (flac *Flac) mdBlockPicture(blDataLen int64) error {
-	if flac.release.Cover() != nil {
-		flac.r.SkipBytes(blDataLen)
-		return nil
+	return flacPictureMetadata(flac.r.ReadBytes(blDataLen), flac.release)
+}
+
+// Parsing of the picture block data. It is used by Vorbis comment METADATA_BLOCK_PICTURE too.
+func flacPictureMetadata(d []byte, release *md.Release) error {
+	if len(d) < 32 {
+		return ErrFLACIncorrectPictureblockSize
 	}
 	picture := md.PictureInAudio{PictureMetadata: &md.PictureMetadata{}}
-	d := flac.r.ReadBytes(blDataLen)
 	picture.PictType = md.PictType(encb.BigEndian.Uint32(d[:4]))
 	x := encb.BigEndian.Uint32(d[4:8])
+	if 32+uint64(x) > uint64(len(d)) {
+		return ErrFLACIncorrectPictureblockSize
+	}
 	picture.MimeType = string(d[8 : 8+x])
 	pos := 8 + x
 	x = encb.BigEndian.Uint32(d[pos : 4+pos])
 	pos += 4
+	if uint64(pos)+uint64(x)+20 > uint64(len(d)) {
+		return ErrFLACIncorrectPictureblockSize
+	}
 	description := strings.TrimSpace(string(d[pos : pos+x]))
 	_, err := url.ParseRequestURI(description)
 	if err == nil {
@@ -188,10 +194,10 @@ func (flac *Flac) mdBlockPicture(blDataLen int64) error {
 	pos += 4
 	picture.Size = encb.BigEndian.Uint32(d[pos : pos+4])
 	pos += 4
-	if blDataLen != 32+int64(len(picture.MimeType)+len(description))+int64(picture.Size) {
+	if uint64(len(d)) != uint64(pos)+uint64(picture.Size) {
 		return ErrFLACIncorrectPictureblockSize
 	}
-	picture.Data = d[pos:]
-	flac.release.Pictures = append(flac.release.Pictures, &picture)
+	picture.Data = append([]byte{}, d[pos:]...)
+	addPicture(release, &picture)
 	return nil
 }
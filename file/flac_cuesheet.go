@@ -0,0 +1,147 @@
+// FLAC CUESHEET metadata block processing.
+// Specification link: https://xiph.org/flac/format.html#metadata_block_cuesheet
+
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	encb "encoding/binary"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+const (
+	flacCueSheetHeaderSize = 396   // catalog(128), lead-in(8), flags and reserved(259), tracks(1)
+	flacCueTrackHeaderSize = 36    // offset(8), number(1), ISRC(12), flags and reserved(14), indices(1)
+	flacCueIndexSize       = 12    // offset(8), number(1), reserved(3)
+	flacCDSamplesPerFrame  = 588   // 44100 Hz / 75 CD frames per second
+	flacCDLeadIn           = 88200 // 2 seconds
+)
+
+// FlacCueSheet describes the content of CUESHEET metadata block (the disc table of contents).
+// The last track is the lead-out one.
+type FlacCueSheet struct {
+	CatalogNumber string         `json:"catalog_number,omitempty"`
+	LeadIn        uint64         `json:"lead_in"` // in samples
+	IsCD          bool           `json:"is_cd"`
+	Tracks        []FlacCueTrack `json:"tracks"`
+}
+
+// FlacCueTrack describes the track of the cue sheet. Offsets are in samples
+// relative to the beginning of the FLAC audio stream.
+type FlacCueTrack struct {
+	Offset      uint64         `json:"offset"`
+	Number      int            `json:"number"`
+	ISRC        string         `json:"isrc,omitempty"`
+	Audio       bool           `json:"audio"`
+	PreEmphasis bool           `json:"pre_emphasis,omitempty"`
+	Indices     []FlacCueIndex `json:"indices,omitempty"`
+}
+
+// FlacCueIndex describes the track index point. Offset is in samples relative to the track offset.
+type FlacCueIndex struct {
+	Offset uint64 `json:"offset"`
+	Number int    `json:"number"`
+}
+
+// Parsing of the CUESHEET block data.
+func flacCueSheet(d []byte) (*FlacCueSheet, error) {
+	if len(d) < flacCueSheetHeaderSize {
+		return nil, ErrFLACIncorrectCueSheet
+	}
+	cs := FlacCueSheet{
+		CatalogNumber: id3v1String(d[:128]),
+		LeadIn:        encb.BigEndian.Uint64(d[128:136]),
+		IsCD:          d[136]&0x80 != 0,
+	}
+	pos := flacCueSheetHeaderSize
+	for i := 0; i < int(d[395]); i++ {
+		if len(d) < pos+flacCueTrackHeaderSize {
+			return nil, ErrFLACIncorrectCueSheet
+		}
+		track := FlacCueTrack{
+			Offset:      encb.BigEndian.Uint64(d[pos : pos+8]),
+			Number:      int(d[pos+8]),
+			ISRC:        string(bytes.TrimRight(d[pos+9:pos+21], "\x00")),
+			Audio:       d[pos+21]&0x80 == 0,
+			PreEmphasis: d[pos+21]&0x40 != 0,
+		}
+		indices := int(d[pos+35])
+		pos += flacCueTrackHeaderSize
+		if len(d) < pos+indices*flacCueIndexSize {
+			return nil, ErrFLACIncorrectCueSheet
+		}
+		for j := 0; j < indices; j++ {
+			track.Indices = append(track.Indices, FlacCueIndex{
+				Offset: encb.BigEndian.Uint64(d[pos : pos+8]),
+				Number: int(d[pos+8]),
+			})
+			pos += flacCueIndexSize
+		}
+		cs.Tracks = append(cs.Tracks, track)
+	}
+	if len(cs.Tracks) == 0 {
+		return nil, ErrFLACIncorrectCueSheet
+	}
+	return &cs, nil
+}
+
+// Start returns the offset of the track start (index 01 or the first index) in samples.
+func (track *FlacCueTrack) Start() uint64 {
+	for _, index := range track.Indices {
+		if index.Number == 1 {
+			return track.Offset + index.Offset
+		}
+	}
+	if len(track.Indices) > 0 {
+		return track.Offset + track.Indices[0].Offset
+	}
+	return track.Offset
+}
+
+// Attaches the disc image cue sheet to the disc: the media catalog number is the release
+// barcode, for CD the media type and the freedb disc ID are set. The table of contents itself
+// is available as Flac.CueSheet.
+func (cs *FlacCueSheet) apply(release *md.Release, disc *md.Disc) {
+	if strings.Trim(cs.CatalogNumber, "0") != "" {
+		setBarcode(cs.CatalogNumber, release)
+	}
+	if !cs.IsCD {
+		return
+	}
+	if disc.Format == nil {
+		disc.Format = &md.DiscFormat{}
+	}
+	if disc.Format.Media == 0 {
+		disc.Format.Media = md.MediaCD
+	}
+	if _, ok := disc.IDs[md.ID]; !ok {
+		disc.IDs[md.ID] = cs.FreedbID()
+	}
+}
+
+// FreedbID calculates the freedb (CDDB) disc ID by the CD table of contents.
+func (cs *FlacCueSheet) FreedbID() string {
+	if len(cs.Tracks) < 2 {
+		return ""
+	}
+	leadIn := cs.LeadIn
+	if leadIn == 0 {
+		leadIn = flacCDLeadIn
+	}
+	seconds := func(offset uint64) int {
+		return int((leadIn + offset) / flacCDSamplesPerFrame / 75)
+	}
+	tracks := cs.Tracks[:len(cs.Tracks)-1]
+	var n int
+	for i := range tracks {
+		for s := seconds(tracks[i].Start()); s > 0; s /= 10 {
+			n += s % 10
+		}
+	}
+	t := seconds(cs.Tracks[len(cs.Tracks)-1].Offset) - seconds(tracks[0].Start())
+	return fmt.Sprintf("%08x", (n%0xff)<<24|t<<8|len(tracks))
+}
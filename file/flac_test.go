@@ -0,0 +1,115 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+// Формирует FLAC-поток из блока STREAMINFO (44100 Hz, 16 bit, stereo) и блоков метаданных.
+func flacTestStream(totalSamples uint64, blocks ...[]byte) []byte {
+	info := make([]byte, 34)
+	encb.BigEndian.PutUint64(info[10:], 44100<<44|1<<41|15<<36|totalSamples)
+	blocks = append([][]byte{{streamInfoBlock}, info}, blocks...)
+	d := []byte(flacSign)
+	for i := 0; i < len(blocks); i += 2 {
+		header := make([]byte, 4)
+		encb.BigEndian.PutUint32(header, uint32(len(blocks[i+1])))
+		header[0] = blocks[i][0]
+		if i == len(blocks)-2 {
+			header[0] |= 0x80
+		}
+		d = append(d, header...)
+		d = append(d, blocks[i+1]...)
+	}
+	return d
+}
+
+func flacTestCueTrack(offset uint64, number, flags byte, isrc string, indices ...uint64) []byte {
+	d := make([]byte, flacCueTrackHeaderSize)
+	encb.BigEndian.PutUint64(d, offset)
+	d[8] = number
+	copy(d[9:21], isrc)
+	d[21] = flags
+	d[35] = byte(len(indices) / 2)
+	for i := 0; i < len(indices); i += 2 {
+		index := make([]byte, flacCueIndexSize)
+		encb.BigEndian.PutUint64(index, indices[i+1])
+		index[8] = byte(indices[i])
+		d = append(d, index...)
+	}
+	return d
+}
+
+func TestFlacCueSheet(t *testing.T) {
+	cs := make([]byte, flacCueSheetHeaderSize)
+	copy(cs, "1234567890123")
+	encb.BigEndian.PutUint64(cs[128:], 88200)
+	cs[136] = 0x80
+	cs[395] = 3
+	cs = append(cs, flacTestCueTrack(0, 1, 0, "USABC0000001", 1, 0)...)
+	cs = append(cs, flacTestCueTrack(441000, 2, 0x40, "", 0, 0, 1, 44100)...)
+	cs = append(cs, flacTestCueTrack(2646000, 170, 0, "")...)
+	d := flacTestStream(2646000, []byte{cueSheetBlock}, cs)
+
+	release := md.NewRelease()
+	tr := md.NewTrack()
+	tr.FileInfo.FileSize = int64(len(d))
+	flac := new(Flac)
+	require.NoError(t, flac.TrackMetadata(bytes.NewReader(d), release, tr))
+	require.NotNil(t, flac.CueSheet)
+	assert.Equal(t, flac.CueSheet.CatalogNumber, "1234567890123")
+	assert.True(t, flac.CueSheet.IsCD)
+	assert.Equal(t, len(flac.CueSheet.Tracks), 3)
+	assert.Equal(t, flac.CueSheet.Tracks[1].Start(), uint64(485100))
+	assert.True(t, flac.CueSheet.Tracks[1].PreEmphasis)
+	assert.True(t, flac.CueSheet.Tracks[1].Audio)
+	assert.Empty(t, tr.IDs["isrc"]) // CD image
+
+	disc := tr.Disc()
+	assert.Equal(t, disc.Format.Media, md.MediaCD)
+	assert.Equal(t, disc.IDs[md.ID], "06003c02")
+	assert.Equal(t, release.Publishing[0].IDs[md.Barcode], "1234567890123")
+	assert.Equal(t, flac.CueSheet.LeadIn, uint64(88200))
+	data, err := json.Marshal(flac.CueSheet.Tracks[1])
+	require.NoError(t, err)
+	assert.JSONEq(t, string(data), `{"offset": 441000, "number": 2, "audio": true, "pre_emphasis": true,
+		"indices": [{"offset": 0, "number": 0}, {"offset": 44100, "number": 1}]}`)
+}
+
+func TestFlacCueSheetSingleTrack(t *testing.T) {
+	cs := make([]byte, flacCueSheetHeaderSize)
+	copy(cs, "1234567890123")
+	cs[136] = 0x80
+	cs[395] = 2
+	cs = append(cs, flacTestCueTrack(0, 1, 0, "USABC0000001", 1, 0)...)
+	cs = append(cs, flacTestCueTrack(441000, 170, 0, "")...)
+	d := flacTestStream(441000, []byte{cueSheetBlock}, cs)
+	tr := md.NewTrack()
+	release := md.NewRelease()
+	flac := new(Flac)
+	require.NoError(t, flac.TrackMetadata(bytes.NewReader(d), release, tr))
+	assert.Equal(t, tr.IDs["isrc"], "USABC0000001")
+	assert.Nil(t, flac.CueSheet) // not a disc image
+	assert.Empty(t, tr.Disc().IDs[md.ID])
+	assert.Empty(t, release.Publishing)
+}
+
+func TestFlacIncorrectCueSheet(t *testing.T) {
+	cs := make([]byte, flacCueSheetHeaderSize)
+	cs[395] = 1
+	d := flacTestStream(441000, []byte{cueSheetBlock}, cs)
+	flac := new(Flac)
+	tr := md.NewTrack()
+	require.NoError(t, flac.TrackMetadata(bytes.NewReader(d), md.NewRelease(), tr))
+	assert.Nil(t, flac.CueSheet)
+	assert.Equal(t, flac.Warnings, []string{ErrFLACIncorrectCueSheet.Error()})
+	assert.Equal(t, tr.AudioInfo.Samplerate, 44100)
+	_, err := flacCueSheet(cs)
+	assert.Equal(t, err, ErrFLACIncorrectCueSheet)
+}
@@ -0,0 +1,148 @@
+// ID3v1 processing module.
+// Specification links: https://id3.org/ID3v1
+// Enhanced tag: https://en.wikipedia.org/wiki/ID3#ID3v1_and_ID3v1.1
+
+package file
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+)
+
+const (
+	id3v1Sign    = "TAG"
+	id3v1ExtSign = "TAG+"
+	id3v1Size    = 128
+	id3v1ExtSize = 227
+)
+
+var errID3v1NotFound = errors.New("has no ID3v1 sign mark")
+
+// ID3v1Genres describes the genre names by its index including Winamp extensions.
+var ID3v1Genres = []string{
+	// ID3v1
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop", "Jazz",
+	"Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno",
+	"Industrial", "Alternative", "Ska", "Death Metal", "Pranks", "Soundtrack", "Euro-Techno",
+	"Ambient", "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical", "Instrumental",
+	"Acid", "House", "Game", "Sound Clip", "Gospel", "Noise", "Alternative Rock", "Bass", "Soul",
+	"Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic",
+	"Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native American", "Cabaret", "New Wave", "Psychedelic", "Rave", "Showtunes", "Trailer",
+	"Lo-Fi", "Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock",
+	// Winamp extensions
+	"Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebop", "Latin", "Revival",
+	"Celtic", "Bluegrass", "Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock",
+	"Symphonic Rock", "Slow Rock", "Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour",
+	"Speech", "Chanson", "Opera", "Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus",
+	"Porn Groove", "Satire", "Slow Jam", "Club", "Tango", "Samba", "Folklore", "Ballad",
+	"Power Ballad", "Rhythmic Soul", "Freestyle", "Duet", "Punk Rock", "Drum Solo", "A Cappella",
+	"Euro-House", "Dance Hall", "Goa", "Drum & Bass", "Club-House", "Hardcore Techno", "Terror",
+	"Indie", "BritPop", "Negerpunk", "Polsk Punk", "Beat", "Christian Gangsta Rap", "Heavy Metal",
+	"Black Metal", "Crossover", "Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "JPop", "Synthpop", "Abstract", "Art Rock", "Baroque", "Bhangra",
+	"Big Beat", "Breakbeat", "Chillout", "Downtempo", "Dub", "EBM", "Eclectic", "Electro",
+	"Electroclash", "Emo", "Experimental", "Garage", "Global", "IDM", "Illbient", "Industro-Goth",
+	"Jam Band", "Krautrock", "Leftfield", "Lounge", "Math Rock", "New Romantic", "Nu-Breakz",
+	"Post-Punk", "Post-Rock", "Psytrance", "Shoegaze", "Space Rock", "Trop Rock", "World Music",
+	"Neoclassical", "Audiobook", "Audio Theatre", "Neue Deutsche Welle", "Podcast", "Indie Rock",
+	"G-Funk", "Dubstep", "Garage Rock", "Psybient",
+}
+
+// ID3v1Speeds describes the speed values of the enhanced tag.
+var ID3v1Speeds = []string{"", "slow", "medium", "fast", "hardcore"}
+
+// ID3v1Metadata читает тег ID3v1/ID3v1.1 в конце файла с учетом расширенного блока "TAG+".
+// Возвращаются теги, известные схеме ID3v1, прочие сохраняются в track.Unprocessed.
+func ID3v1Metadata(r *binary.Reader, track *md.Track) (map[TagKey]string, error) {
+	end := r.SeekBytes(0, io.SeekEnd)
+	if end < id3v1Size {
+		return nil, errID3v1NotFound
+	}
+	r.SeekBytes(end-id3v1Size, io.SeekStart)
+	d := append([]byte{}, r.ReadBytes(id3v1Size)...)
+	if string(d[:3]) != id3v1Sign {
+		return nil, errID3v1NotFound
+	}
+	title, artist, album := d[3:33], d[33:63], d[63:93]
+	fields := map[TagName]string{
+		"YEAR":    id3v1String(d[93:97]),
+		"COMMENT": id3v1String(d[97:127]),
+	}
+	// ID3v1.1: comment(28), zero byte, track number(1)
+	if d[125] == 0 && d[126] != 0 {
+		fields["COMMENT"] = id3v1String(d[97:125])
+		fields["TRACK"] = strconv.Itoa(int(d[126]))
+	}
+	if int(d[127]) < len(ID3v1Genres) {
+		fields["GENRE"] = ID3v1Genres[d[127]]
+	}
+	// Enhanced tag: "TAG+"(4), title(60), artist(60), album(60), speed(1), genre(30),
+	// start time(6), end time(6). Title, artist and album continue the ID3v1 fields.
+	if end >= id3v1Size+id3v1ExtSize {
+		r.SeekBytes(end-id3v1Size-id3v1ExtSize, io.SeekStart)
+		if ext := r.ReadBytes(id3v1ExtSize); string(ext[:4]) == id3v1ExtSign {
+			title = append(title[:len(title):len(title)], ext[4:64]...)
+			artist = append(artist[:len(artist):len(artist)], ext[64:124]...)
+			album = append(album[:len(album):len(album)], ext[124:184]...)
+			if int(ext[184]) < len(ID3v1Speeds) {
+				fields["TAG+:SPEED"] = ID3v1Speeds[ext[184]]
+			}
+			if genre := id3v1String(ext[185:215]); genre != "" {
+				fields["GENRE"] = genre
+			}
+			fields["TAG+:START_TIME"] = id3v1String(ext[215:221])
+			fields["TAG+:END_TIME"] = id3v1String(ext[221:227])
+		}
+	}
+	fields["TITLE"] = id3v1String(title)
+	fields["ARTIST"] = id3v1String(artist)
+	fields["ALBUM"] = id3v1String(album)
+	processedTags := make(map[TagKey]string)
+	for name, val := range fields {
+		if val == "" {
+			continue
+		}
+		if tag, ok := SchemaTagToUniKey[ID3v1][name]; ok {
+			processedTags[tag] = val
+		} else {
+			track.Unprocessed[name] = val
+		}
+	}
+	return processedTags, nil
+}
+
+// Returns the size of ID3v1 tag (with enhanced block) at the end of the file or 0.
+func id3v1TrailerSize(r *binary.Reader) int64 {
+	end := r.SeekBytes(0, io.SeekEnd)
+	if end < id3v1Size {
+		return 0
+	}
+	r.SeekBytes(end-id3v1Size, io.SeekStart)
+	if string(r.ReadBytes(3)) != id3v1Sign {
+		return 0
+	}
+	if end >= id3v1Size+id3v1ExtSize {
+		r.SeekBytes(end-id3v1Size-id3v1ExtSize, io.SeekStart)
+		if string(r.ReadBytes(4)) == id3v1ExtSign {
+			return id3v1Size + id3v1ExtSize
+		}
+	}
+	return id3v1Size
+}
+
+// Fields are padded with zero bytes or spaces.
+func id3v1String(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(latin1String(b))
+}
@@ -0,0 +1,76 @@
+package file
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+)
+
+// Формирует тег ID3v1.1 с номером трека и жанром.
+func id3v1TestTag(title, artist, album, year, comment string, track, genre byte) []byte {
+	d := make([]byte, id3v1Size)
+	copy(d, id3v1Sign)
+	copy(d[3:33], title)
+	copy(d[33:63], artist)
+	copy(d[63:93], album)
+	copy(d[93:97], year)
+	copy(d[97:125], comment)
+	d[126] = track
+	d[127] = genre
+	return d
+}
+
+func TestID3v1Metadata(t *testing.T) {
+	d := append(make([]byte, 10), id3v1TestTag(
+		"test_track_title", "test_track_artist", "test_album_title", "2003", "comment", 3, 80)...)
+	tr := md.NewTrack()
+	tags, err := ID3v1Metadata(binary.NewReader(bytes.NewReader(d)), tr)
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackTitle], "test_track_title")
+	assert.Equal(t, tags[TrackArtist], "test_track_artist")
+	assert.Equal(t, tags[AlbumTitle], "test_album_title")
+	assert.Equal(t, tags[Year], "2003")
+	assert.Equal(t, tags[Comments], "comment")
+	assert.Equal(t, tags[TrackNumber], "3")
+	assert.Equal(t, tags[Genre], "Folk")
+
+	_, err = ID3v1Metadata(binary.NewReader(bytes.NewReader(make([]byte, 200))), tr)
+	assert.ErrorIs(t, err, errID3v1NotFound)
+}
+
+func TestID3v1EnhancedMetadata(t *testing.T) {
+	ext := make([]byte, id3v1ExtSize)
+	copy(ext, id3v1ExtSign)
+	copy(ext[4:64], "_continued")
+	ext[184] = 2
+	copy(ext[185:215], "Melodic Death Metal")
+	copy(ext[215:221], "001:30")
+	title := "a_title_with_exactly_30_chars_"
+	d := append(ext, id3v1TestTag(title, "", "", "", "", 0, 255)...)
+	tr := md.NewTrack()
+	tags, err := ID3v1Metadata(binary.NewReader(bytes.NewReader(d)), tr)
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackTitle], title+"_continued")
+	assert.Equal(t, tags[Genre], "Melodic Death Metal")
+	assert.NotContains(t, tags, TrackNumber)
+	assert.Equal(t, tr.Unprocessed["TAG+:SPEED"], "medium")
+	assert.Equal(t, tr.Unprocessed["TAG+:START_TIME"], "001:30")
+	assert.Equal(t, id3v1TrailerSize(binary.NewReader(bytes.NewReader(d))), int64(id3v1Size+id3v1ExtSize))
+}
+
+func TestID3v1Precedence(t *testing.T) {
+	d := append(make([]byte, 100), apev2TestTag([2]string{"Title", "ape_title"})...)
+	d = append(d, id3v1TestTag("id3v1_title", "", "", "", "", 3, 8)...)
+	tr := md.NewTrack()
+	r := md.NewRelease()
+	tags, err := mergeTrailingTags(
+		binary.NewReader(bytes.NewReader(d)), tr, r, map[TagKey]string{TrackNumber: "4"})
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackTitle], "ape_title")
+	assert.Equal(t, tags[TrackNumber], "4")
+	assert.Equal(t, tags[Genre], "Jazz")
+}
@@ -1,15 +1,65 @@
 package file
 
 import (
+	"bytes"
+	"compress/zlib"
+	encb "encoding/binary"
 	"errors"
+	"io/ioutil"
 	"net/url"
 	"strings"
+	"unicode/utf16"
 
 	md "github.com/ytsiuryn/ds-audiomd"
 	binary "github.com/ytsiuryn/go-binary"
 )
 
-const id3Sign = "ID3"
+const (
+	id3Sign         = "ID3"
+	id3v2HeaderSize = 10
+)
+
+// Tag header flags
+const (
+	id3v2FlagUnsync      = 0x80
+	id3v2FlagExtHeader   = 0x40
+	id3v22FlagCompressed = 0x40
+	id3v2FlagFooter      = 0x10
+)
+
+// Frame header flags (format flags byte)
+const (
+	id3v23FrameCompressed = 0x80
+	id3v23FrameEncrypted  = 0x40
+	id3v23FrameGrouping   = 0x20
+	id3v24FrameGrouping   = 0x40
+	id3v24FrameCompressed = 0x08
+	id3v24FrameEncrypted  = 0x04
+	id3v24FrameUnsync     = 0x02
+	id3v24FrameDataLength = 0x01
+)
+
+// Public errors
+var (
+	ErrID3v2VersionNotSupport = errors.New("ID3v2 version is not supported")
+	ErrID3v2IncorrectFrame    = errors.New("incorrect ID3v2 frame")
+)
+
+// ID3v22FrameIDs describes the correspondence of ID3v2.2 frame IDs to ID3v2.3 ones.
+var ID3v22FrameIDs = map[string]string{
+	"BUF": "RBUF", "CNT": "PCNT", "COM": "COMM", "CRA": "AENC", "ETC": "ETCO", "EQU": "EQUA",
+	"GEO": "GEOB", "IPL": "IPLS", "LNK": "LINK", "MCI": "MCDI", "MLL": "MLLT", "PIC": "APIC",
+	"POP": "POPM", "REV": "RVRB", "RVA": "RVAD", "SLT": "SYLT", "STC": "SYTC", "TAL": "TALB",
+	"TBP": "TBPM", "TCM": "TCOM", "TCO": "TCON", "TCP": "TCMP", "TCR": "TCOP", "TDA": "TDAT",
+	"TDY": "TDLY", "TEN": "TENC", "TFT": "TFLT", "TIM": "TIME", "TKE": "TKEY", "TLA": "TLAN",
+	"TLE": "TLEN", "TMT": "TMED", "TOA": "TOPE", "TOF": "TOFN", "TOL": "TOLY", "TOR": "TORY",
+	"TOT": "TOAL", "TP1": "TPE1", "TP2": "TPE2", "TP3": "TPE3", "TP4": "TPE4", "TPA": "TPOS",
+	"TPB": "TPUB", "TRC": "TSRC", "TRD": "TRDA", "TRK": "TRCK", "TS2": "TSO2", "TSA": "TSOA",
+	"TSC": "TSOC", "TSI": "TSIZ", "TSP": "TSOP", "TSS": "TSSE", "TST": "TSOT", "TT1": "TIT1",
+	"TT2": "TIT2", "TT3": "TIT3", "TXT": "TEXT", "TXX": "TXXX", "TYE": "TYER", "UFI": "UFID",
+	"ULT": "USLT", "WAF": "WOAF", "WAR": "WOAR", "WAS": "WOAS", "WCM": "WCOM", "WCP": "WCOP",
+	"WPB": "WPUB", "WXX": "WXXX",
+}
 
 var (
 	errID3NotFound = errors.New("ID3v2 section has incorrect sign mark")
@@ -28,87 +78,396 @@ func ID3v2CheckSign(r *binary.Reader) bool {
 // $01 UTF-16 [UTF-16] encoded Unicode [UNICODE] with BOM. All strings in the same frame SHALL have the same byteorder. Terminated with $00 00.
 // $02 UTF-16BE [UTF-16] encoded Unicode [UNICODE] without BOM. Terminated with $00 00.
 // $03 UTF-8 [UTF-8] encoded Unicode [UNICODE]. Terminated with $00.”
+// Null-separated values are joined with $00 character.
 func id3v2DecodeString(b []byte) (string, error) {
-	var err error
-	ret := b
-	switch b[0] {
-	case 0:
-		ret = b[1:]
-	case 1:
-		ret, err = binary.FromUTF16LE(b[1:])
-	case 2:
-		ret, err = binary.FromUTF16BE(b[1:])
+	if len(b) == 0 {
+		return "", nil
 	}
-	if err != nil {
-		return "", err
+	return strings.Join(id3v2DecodeStrings(b[1:], b[0]), "\x00"), nil
+}
+
+// Splits the terminated strings of the encoding and decodes them. Trailing terminators
+// are ignored.
+func id3v2DecodeStrings(b []byte, encoding byte) []string {
+	var ret []string
+	termLen := id3v2TerminatorLen(encoding)
+	for len(b) > 0 {
+		end := id3v2StringEnd(b, encoding)
+		ret = append(ret, id3v2Text(b[:end], encoding))
+		if end += termLen; end > len(b) {
+			break
+		}
+		b = b[end:]
+	}
+	for len(ret) > 1 && ret[len(ret)-1] == "" {
+		ret = ret[:len(ret)-1]
+	}
+	return ret
+}
+
+// Decodes the string without terminator.
+func id3v2Text(b []byte, encoding byte) string {
+	switch encoding {
+	case 0:
+		return latin1String(b)
+	case 1, 2:
+		var order encb.ByteOrder = encb.BigEndian
+		if encoding == 1 {
+			order = encb.LittleEndian // BOM is expected
+		}
+		if len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe {
+			order, b = encb.LittleEndian, b[2:]
+		} else if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+			order, b = encb.BigEndian, b[2:]
+		}
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			u[i] = order.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(u))
 	}
-	return string(binary.FromASCIIZ(ret)), nil
+	return string(b)
 }
 
 // ID3v2Metadata is main fuction to read ID3 section data
 func ID3v2Metadata(r *binary.Reader, track *md.Track, release *md.Release) (
 	map[TagKey]string, error) {
+	tag, err := id3v2Metadata(r, track, release)
+	if err != nil {
+		return nil, err
+	}
+	return tag.processedTags, nil
+}
+
+// Reads ID3 section data. The parsed tag contains the processed tags and the track chapters.
+func id3v2Metadata(r *binary.Reader, track *md.Track, release *md.Release) (*id3v2Tag, error) {
 	if !ID3v2CheckSign(r) {
 		return nil, errID3NotFound
 	}
-	r.SkipBytes(6) // Sign mark(3), ID3Info.version(2), flags (1)
-	sectionSize := parseBlockSize(r.ReadBytes(4))
-	d := r.ReadBytes(sectionSize)
-	var pos, frameSize int64
-	var frameID string
-	processedTags := make(map[TagKey]string)
-	for pos < sectionSize {
-		frameID = string(d[pos : pos+4])
-		pos += 4
-		frameSize = parseBlockSize(d[pos : pos+4])
-		pos += 4 + 2 // 2(frame flags)
-		if frameID == "APIC" {
-			id3v2PictMetadata(r, d[pos:pos+frameSize], release)
-		} else {
-			frameValue, err := id3v2DecodeString(d[pos : pos+frameSize])
-			if err != nil {
-				return nil, err
+	// Sign mark(3), version(2), flags(1), size(4)
+	header := r.ReadBytes(id3v2HeaderSize)
+	version := header[3]
+	if version < 2 || version > 4 {
+		return nil, ErrID3v2VersionNotSupport
+	}
+	flags := header[5]
+	sectionSize := parseBlockSize(header[6:10])
+	d := append([]byte{}, r.ReadBytes(sectionSize)...)
+	if version == 4 && flags&id3v2FlagFooter != 0 {
+		r.SkipBytes(id3v2HeaderSize)
+	}
+	tag := id3v2Tag{version: version, track: track, release: release,
+		processedTags: make(map[TagKey]string)}
+	if version == 2 && flags&id3v22FlagCompressed != 0 {
+		return &tag, nil // compression scheme is not defined by specification
+	}
+	if version < 4 && flags&id3v2FlagUnsync != 0 {
+		d = id3v2Unsync(d)
+	}
+	if version > 2 && flags&id3v2FlagExtHeader != 0 {
+		var err error
+		if d, err = id3v2SkipExtHeader(d, version); err != nil {
+			return nil, err
+		}
+	}
+	if err := id3v2Frames(d, version, flags, tag.frame); err != nil {
+		return nil, err
+	}
+	tag.sortChapters()
+	return &tag, nil
+}
+
+// Состояние разбора тега ID3v2.
+type id3v2Tag struct {
+	version       byte
+	track         *md.Track
+	release       *md.Release
+	processedTags map[TagKey]string
+	commentLang   string // language of the track notes
+	chapters      []*ID3v2Chapter
+	tocs          []*id3v2TOC
+}
+
+// Frame processing. The frame ID of ID3v2.2 is already converted to ID3v2.3 one.
+func (tag *id3v2Tag) frame(frameID string, frame []byte) error {
+	switch {
+	case frameID == "APIC":
+		id3v2PictMetadata(frame, tag.version, tag.release)
+		return nil
+	case frameID == "CHAP":
+		return tag.chapter(frame)
+	case frameID == "CTOC":
+		return tag.tableOfContents(frame)
+	case frameID == "SYLT":
+		return tag.syncedLyrics(frame)
+	case frameID == "USLT":
+		return tag.unsyncedLyrics(frame)
+	case frameID == "UFID":
+		return tag.uniqueFileID(frame)
+	case frameID == "POPM":
+		return tag.popularimeter(frame)
+	case frameID == "PCNT":
+		return tag.playCounter(frame)
+	case frameID == "PRIV":
+		return tag.private(frame)
+	case frameID == "COMM":
+		return tag.comment(frame)
+	case frameID == "TXXX":
+		return tag.userText(frame)
+	case frameID == "WXXX":
+		return tag.userURL(frame)
+	case frameID[0] == 'W':
+		tag.addValue(frameID, id3v2URL(frame))
+		return nil
+	case frameID == "TIPL" || frameID == "TMCL" || frameID == "IPLS":
+		if len(frame) > 0 {
+			tag.credits(frameID, id3v2DecodeStrings(frame[1:], frame[0]))
+		}
+		return nil
+	case frameID[0] == 'T':
+		if len(frame) > 0 {
+			// ID3v2.4 text frame may contain null-separated values
+			tag.addValue(frameID, strings.Join(id3v2DecodeStrings(frame[1:], frame[0]), "; "))
+		}
+		return nil
+	}
+	frameValue, err := id3v2DecodeString(frame)
+	if err != nil {
+		return err
+	}
+	tag.addValue(frameID, frameValue)
+	return nil
+}
+
+func (tag *id3v2Tag) addValue(frameID, frameValue string) {
+	if key, ok := SchemaTagToUniKey[ID3v2][frameID]; ok {
+		tag.processedTags[key] = frameValue
+	} else {
+		tag.track.Unprocessed[frameID] = frameValue
+	}
+}
+
+// Involved people list (TIPL, IPLS) and musician credits list (TMCL) contain role/name pairs,
+// the last role without name is ignored. Roles known by ID3v2 scheme (i.e. "TIPL:producer")
+// are added to the processed tags (names are separated with "; "), other roles
+// (i.e. instruments) are added to the record actor roles as is.
+func (tag *id3v2Tag) credits(frameID string, values []string) {
+	for i := 0; i+1 < len(values); i += 2 {
+		role, name := strings.TrimSpace(values[i]), strings.TrimSpace(values[i+1])
+		if name == "" {
+			continue
+		}
+		key, ok := SchemaTagToUniKey[ID3v2][frameID+":"+role]
+		if !ok {
+			key, ok = SchemaTagToUniKey[ID3v2][frameID+":"+strings.ToLower(role)]
+		}
+		if ok {
+			if prev, ok := tag.processedTags[key]; ok && prev != name {
+				name = prev + "; " + name
 			}
-			if frameID == "COMM" {
-				frameValue = frameValue[4:] // 3(lang)+1(0x0)
-			} else if frameID == "TXXX" {
-				flds := strings.SplitN(frameValue, "\x00", 2)
-				frameID = "TXXX:" + flds[0]
-				frameValue = flds[1]
+			tag.processedTags[key] = name
+		} else if role != "" {
+			tag.track.Record.ActorRoles.Add(name, role)
+		} else {
+			tag.track.Record.Actors.Add(name, 0, "")
+		}
+	}
+}
+
+// Iterates the frames of the tag data. ID3v2.3/2.4 frame header: ID(4), size(4), flags(2).
+// ID3v2.2 frame header: ID(3), size(3). ID3v2.2 frame IDs are converted to ID3v2.3 ones.
+// Frame data is passed to the handler decoded according to the frame flags,
+// encrypted frames are skipped.
+func id3v2Frames(d []byte, version, tagFlags byte,
+	handler func(frameID string, frame []byte) error) error {
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	for pos := 0; pos+headerLen <= len(d); {
+		frameID := string(d[pos : pos+idLen])
+		var frameSize int
+		var frameFlags byte
+		switch version {
+		case 2:
+			frameSize = int(d[pos+3])<<16 | int(d[pos+4])<<8 | int(d[pos+5])
+			if id, ok := ID3v22FrameIDs[frameID]; ok {
+				frameID = id
 			}
-			if tag, ok := SchemaTagToUniKey[ID3v2][frameID]; ok {
-				processedTags[tag] = frameValue
-			} else {
-				track.Unprocessed[frameID] = frameValue
+		case 3:
+			frameSize = int(encb.BigEndian.Uint32(d[pos+4 : pos+8]))
+			frameFlags = d[pos+9]
+		case 4:
+			frameSize = id3v24FrameSize(d, pos)
+			frameFlags = d[pos+9]
+		}
+		pos += headerLen
+		if frameSize < 0 || frameSize > len(d)-pos {
+			return ErrID3v2IncorrectFrame
+		}
+		frame, ok, err := id3v2FrameData(d[pos:pos+frameSize], version, tagFlags, frameFlags)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err = handler(frameID, frame); err != nil {
+				return err
 			}
 		}
 		pos += frameSize
 		// format alignment
-		for ; pos < sectionSize && d[pos] == 0; pos++ {
+		for ; pos < len(d) && d[pos] == 0; pos++ {
+		}
+	}
+	return nil
+}
+
+// ID3v2.4 frame size is synchsafe integer, but some taggers (i.e. iTunes) write the plain one.
+// The plain size is used if the synchsafe one does not point to the next frame or padding.
+func id3v24FrameSize(d []byte, pos int) int {
+	b := d[pos+4 : pos+8]
+	plain := int(encb.BigEndian.Uint32(b))
+	if (b[0]|b[1]|b[2]|b[3])&0x80 != 0 {
+		return plain
+	}
+	synchsafe := int(parseBlockSize(b))
+	if synchsafe < 0x80 || id3v2NextFrameValid(d, pos+10+synchsafe) ||
+		!id3v2NextFrameValid(d, pos+10+plain) {
+		return synchsafe
+	}
+	return plain
+}
+
+// Checks that the position is the end of tag data, padding or valid frame ID.
+func id3v2NextFrameValid(d []byte, pos int) bool {
+	if pos == len(d) || pos < len(d) && d[pos] == 0 {
+		return true
+	}
+	if pos+4 > len(d) {
+		return false
+	}
+	for _, c := range d[pos : pos+4] {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
 		}
 	}
-	return processedTags, nil
+	return true
 }
 
-// APIC tag processing
-func id3v2PictMetadata(r *binary.Reader, frame []byte, release *md.Release) {
-	if release.Cover() != nil {
-		return
+// Removes additional frame header data (group ID, encryption method, decompressed or data
+// length), reverses unsynchronisation and decompresses zlib data. ID3v2.3 additional data
+// order: decompressed size(4), encryption method(1), group ID(1). ID3v2.4 order: group ID(1),
+// encryption method(1), data length indicator(4). Returns false for encrypted frames.
+func id3v2FrameData(d []byte, version, tagFlags, frameFlags byte) ([]byte, bool, error) {
+	var compressed, encrypted, unsync bool
+	var extraLen int
+	switch version {
+	case 3:
+		compressed = frameFlags&id3v23FrameCompressed != 0
+		encrypted = frameFlags&id3v23FrameEncrypted != 0
+		if compressed {
+			extraLen += 4
+		}
+		if frameFlags&id3v23FrameGrouping != 0 {
+			extraLen++
+		}
+	case 4:
+		compressed = frameFlags&id3v24FrameCompressed != 0
+		encrypted = frameFlags&id3v24FrameEncrypted != 0
+		unsync = frameFlags&id3v24FrameUnsync != 0 || tagFlags&id3v2FlagUnsync != 0
+		if frameFlags&id3v24FrameGrouping != 0 {
+			extraLen++
+		}
+		if frameFlags&id3v24FrameDataLength != 0 {
+			extraLen += 4
+		}
+	}
+	if encrypted {
+		return nil, false, nil
+	}
+	if extraLen > len(d) {
+		return nil, false, ErrID3v2IncorrectFrame
+	}
+	d = d[extraLen:]
+	if unsync {
+		d = id3v2Unsync(d)
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(d))
+		if err != nil {
+			return nil, false, err
+		}
+		defer zr.Close()
+		if d, err = ioutil.ReadAll(zr); err != nil {
+			return nil, false, err
+		}
+	}
+	return d, true, nil
+}
+
+// Reverses unsynchronisation scheme: $FF 00 byte pairs are replaced with $FF.
+func id3v2Unsync(d []byte) []byte {
+	return bytes.ReplaceAll(d, []byte{0xff, 0}, []byte{0xff})
+}
+
+// Extended header: size(4), ... ID3v2.3 size is plain integer excluding the size field,
+// ID3v2.4 size is synchsafe integer of the whole extended header.
+func id3v2SkipExtHeader(d []byte, version byte) ([]byte, error) {
+	if len(d) < 4 {
+		return nil, ErrID3v2IncorrectFrame
+	}
+	var size int64
+	if version == 3 {
+		size = 4 + int64(encb.BigEndian.Uint32(d[:4]))
+	} else {
+		size = parseBlockSize(d[:4])
+	}
+	if size < 4 || size > int64(len(d)) {
+		return nil, ErrID3v2IncorrectFrame
+	}
+	return d[size:], nil
+}
+
+// APIC tag processing. The picture is added to the release pictures.
+func id3v2PictMetadata(frame []byte, version byte, release *md.Release) {
+	if pict := id3v2Picture(frame, version); pict != nil {
+		addPicture(release, pict)
+	}
+}
+
+// APIC frame parsing: encoding(1), MIME type, picture type(1), description, picture data.
+// ID3v2.2 PIC frame has 3 chars image format instead of MIME type.
+func id3v2Picture(frame []byte, version byte) *md.PictureInAudio {
+	if len(frame) < 2 {
+		return nil
 	}
 	var pos, x uint32
 	pict := md.PictureInAudio{PictureMetadata: &md.PictureMetadata{}}
-	for ; frame[pos] == 0; pos++ {
+	encoding := frame[0]
+	pos++
+	if version == 2 {
+		if len(frame) < 5 {
+			return nil
+		}
+		pict.MimeType = id3v22ImageMime(string(frame[pos : pos+3]))
+		pos += 3
+	} else {
+		for ; int(pos+x) < len(frame) && frame[pos+x] != 0; x++ {
+		}
+		pict.MimeType = string(frame[pos : pos+x])
+		pos += x + 1
 	}
-	for ; frame[pos+x] != 0; x++ {
+	if int(pos) >= len(frame) {
+		return nil
 	}
-	pict.MimeType = string(frame[pos : pos+x])
-	pos += x + 1
 	pict.PictType = md.PictType(frame[pos])
 	pos++
-	for x = 0; frame[pos+x] != 0; x++ {
+	x = uint32(id3v2StringEnd(frame[pos:], encoding))
+	description, _ := id3v2DecodeString(append([]byte{encoding}, frame[pos:pos+x]...))
+	pos += x + uint32(id3v2TerminatorLen(encoding))
+	if int(pos) > len(frame) {
+		return nil
 	}
-	description := string(frame[pos : pos+x])
-	pos += x + 1
 	_, err := url.ParseRequestURI(description)
 	if err == nil {
 		pict.CoverURL = description
@@ -117,7 +476,41 @@ func id3v2PictMetadata(r *binary.Reader, frame []byte, release *md.Release) {
 	}
 	pict.Size = uint32(len(frame)) - pos
 	pict.Data = frame[pos:]
-	release.Pictures = append(release.Pictures, &pict)
+	return &pict
+}
+
+// Returns the length of the terminated string in the encoding or the data length.
+func id3v2StringEnd(b []byte, encoding byte) int {
+	if id3v2TerminatorLen(encoding) == 1 {
+		if i := bytes.IndexByte(b, 0); i != -1 {
+			return i
+		}
+		return len(b)
+	}
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			return i
+		}
+	}
+	return len(b)
+}
+
+// UTF-16 strings are terminated with $00 00.
+func id3v2TerminatorLen(encoding byte) int {
+	if encoding == 1 || encoding == 2 {
+		return 2
+	}
+	return 1
+}
+
+func id3v22ImageMime(format string) string {
+	switch strings.ToUpper(format) {
+	case "JPG":
+		return "image/jpeg"
+	case "-->":
+		return "-->" // link to the picture
+	}
+	return "image/" + strings.ToLower(format)
 }
 
 func parseBlockSize(b []byte) int64 {
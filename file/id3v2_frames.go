@@ -0,0 +1,464 @@
+// Декодирование структурированных фреймов ID3v2.
+
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+const id3v2MusicbrainzOwner = "http://musicbrainz.org"
+
+// SYLT timestamp formats
+const (
+	id3v2TimestampMPEGFrames = 1
+	id3v2TimestampMs         = 2
+)
+
+// ID3v2SyncedContentTypes describes the content types of SYLT frame.
+var ID3v2SyncedContentTypes = []string{"other", "lyrics", "transcription", "movement",
+	"events", "chord", "trivia", "webpage URLs", "image URLs"}
+
+// Synchronised lyric/text: encoding(1), language(3), timestamp format(1), content type(1),
+// content descriptor, [text, timestamp(4)]...
+// Lyrics and text transcription are set as the track lyrics in LRC format ("[mm:ss.xx]text"
+// lines), other content is stored in track.Unprocessed. Truncated entry ends the content,
+// malformed frame is skipped.
+func (tag *id3v2Tag) syncedLyrics(frame []byte) error {
+	if len(frame) < 6 {
+		return nil
+	}
+	encoding, lang, format, contentType := frame[0], string(frame[1:4]), frame[4], frame[5]
+	descriptor, d := id3v2SplitDescription(frame[6:], encoding)
+	var lines []string
+	for len(d) > 0 {
+		end := id3v2StringEnd(d, encoding)
+		text := id3v2Text(d[:end], encoding)
+		end += id3v2TerminatorLen(encoding)
+		if end+4 > len(d) {
+			break
+		}
+		lines = append(lines, id3v2SyncedLine(encb.BigEndian.Uint32(d[end:end+4]), format, text))
+		d = d[end+4:]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	text := strings.Join(lines, "\n")
+	if contentType > 2 {
+		name := fmt.Sprint(contentType)
+		if int(contentType) < len(ID3v2SyncedContentTypes) {
+			name = ID3v2SyncedContentTypes[contentType]
+		}
+		if descriptor != "" {
+			name += ":" + descriptor
+		}
+		tag.track.Unprocessed["SYLT:"+name] = text
+		return nil
+	}
+	tag.track.SetLyrics(text, true)
+	tag.track.SetLyricsLanguage(lang)
+	return nil
+}
+
+// Unsynchronised lyric/text transcription: encoding(1), language(3), content descriptor, text.
+// Synchronised lyrics take precedence. Malformed frame is skipped.
+func (tag *id3v2Tag) unsyncedLyrics(frame []byte) error {
+	if len(frame) < 4 {
+		return nil
+	}
+	if lyrics := tag.track.Composition.Lyrics; lyrics != nil && lyrics.IsSynchronized {
+		return nil
+	}
+	encoding, lang := frame[0], string(frame[1:4])
+	_, d := id3v2SplitDescription(frame[4:], encoding)
+	tag.track.SetLyrics(id3v2Text(d[:id3v2StringEnd(d, encoding)], encoding), false)
+	tag.track.SetLyricsLanguage(lang)
+	return nil
+}
+
+// Timestamp is absolute time in milliseconds or MPEG frames from the beginning of the file.
+func id3v2SyncedLine(timestamp uint32, format byte, text string) string {
+	text = strings.TrimLeft(text, "\n")
+	if format == id3v2TimestampMs {
+		return fmt.Sprintf("[%02d:%02d.%02d]%s",
+			timestamp/60000, timestamp/1000%60, timestamp%1000/10, text)
+	}
+	return fmt.Sprintf("[frame %d]%s", timestamp, text)
+}
+
+// Comments: encoding(1), language(3), short content description, text.
+// Comments without description in the language of the first of them are the track notes,
+// the language is stored as COMMENT_LANGUAGE. Other comments are stored in track.Unprocessed
+// as "COMM:<language>" (translated notes) and "COMM:<language>:<description>".
+// Malformed frame is skipped.
+func (tag *id3v2Tag) comment(frame []byte) error {
+	if len(frame) < 4 {
+		return nil
+	}
+	lang := id3v2Language(frame[1:4])
+	descr, d := id3v2SplitDescription(frame[4:], frame[0])
+	value := strings.Join(id3v2DecodeStrings(d, frame[0]), "\n")
+	if descr == "" && (lang == "" || tag.commentLang == "" || lang == tag.commentLang) {
+		if tag.commentLang == "" && lang != "" && strings.TrimSpace(value) != "" {
+			tag.commentLang = lang
+			tag.track.Unprocessed["COMMENT_LANGUAGE"] = lang
+		}
+		lang = ""
+	}
+	tag.userValue("COMM", lang, descr, value)
+	return nil
+}
+
+// User defined text: encoding(1), description, value(s). Empty frame is skipped.
+func (tag *id3v2Tag) userText(frame []byte) error {
+	if len(frame) < 1 {
+		return nil
+	}
+	descr, d := id3v2SplitDescription(frame[1:], frame[0])
+	tag.userValue("TXXX", "", descr, strings.Join(id3v2DecodeStrings(d, frame[0]), "; "))
+	return nil
+}
+
+// User defined URL: encoding(1), description, URL (always ISO-8859-1).
+// Empty frame is skipped.
+func (tag *id3v2Tag) userURL(frame []byte) error {
+	if len(frame) < 1 {
+		return nil
+	}
+	descr, d := id3v2SplitDescription(frame[1:], frame[0])
+	tag.userValue("WXXX", "", descr, id3v2URL(d))
+	return nil
+}
+
+// Frames with the same language and description are joined. Known service descriptions
+// are processed separately from the user values.
+func (tag *id3v2Tag) userValue(frameID, lang, descr, value string) {
+	switch descr {
+	case "iTunSMPB":
+		id3v2ITunesGapless(value, tag.track)
+		return
+	case "iTunNORM":
+		tag.track.Unprocessed["ITUNNORM"] = strings.TrimSpace(value)
+		return
+	case "ID3v1 Comment":
+		return // copy of ID3v1 comment, the trailing tag is read separately
+	}
+	if value == "" {
+		return
+	}
+	sep := "; "
+	if frameID == "COMM" {
+		sep = "\n"
+	}
+	if lang != "" {
+		frameID += ":" + lang
+	}
+	if descr != "" {
+		frameID += ":" + descr
+	}
+	if key, ok := SchemaTagToUniKey[ID3v2][frameID]; ok {
+		if prev, ok := tag.processedTags[key]; ok && prev != value {
+			value = prev + sep + value
+		}
+		tag.processedTags[key] = value
+	} else {
+		if prev, ok := tag.track.Unprocessed[frameID]; ok && prev != value {
+			value = prev + sep + value
+		}
+		tag.track.Unprocessed[frameID] = value
+	}
+}
+
+// iTunes gapless info: reserved, encoder delay, padding, original sample count, ...
+// (hexadecimal numbers separated by spaces).
+func id3v2ITunesGapless(value string, track *md.Track) {
+	flds := strings.Fields(value)
+	if len(flds) < 4 {
+		track.Unprocessed["ITUNSMPB"] = strings.TrimSpace(value)
+		return
+	}
+	for i, key := range []string{"", "ENCODER_DELAY", "ENCODER_PADDING", "SAMPLE_COUNT"} {
+		if n, err := strconv.ParseUint(flds[i], 16, 64); err == nil && key != "" {
+			track.Unprocessed[key] = strconv.FormatUint(n, 10)
+		}
+	}
+}
+
+// Unique file identifier: owner identifier (ISO-8859-1), identifier (up to 64 bytes).
+// MusicBrainz recording ID is stored in the record IDs, others in the track IDs by owner.
+// Malformed frame is skipped.
+func (tag *id3v2Tag) uniqueFileID(frame []byte) error {
+	owner, id := id3v2SplitDescription(frame, 0)
+	if owner == "" || len(id) == 0 {
+		return nil
+	}
+	if owner == id3v2MusicbrainzOwner {
+		tag.track.Record.IDs[md.MusicbrainzRecordingID] = string(id)
+	} else {
+		tag.track.IDs[owner] = id3v2BinaryValue(id)
+	}
+	return nil
+}
+
+// Popularimeter: email to user (ISO-8859-1), rating(1), counter (4 or more bytes, optional).
+// Rating 1-255 (0 - unknown) and the play counter are stored per user in track.Unprocessed.
+// Malformed frame is skipped.
+func (tag *id3v2Tag) popularimeter(frame []byte) error {
+	email, d := id3v2SplitDescription(frame, 0)
+	if len(d) == 0 {
+		return nil
+	}
+	key := "POPM"
+	if email != "" {
+		key += ":" + email
+	}
+	if d[0] != 0 {
+		tag.track.Unprocessed[key+":RATING"] = strconv.Itoa(int(d[0]))
+	}
+	if len(d) > 1 {
+		tag.track.Unprocessed[key+":PLAY_COUNT"] = strconv.FormatUint(id3v2Counter(d[1:]), 10)
+	}
+	return nil
+}
+
+// Play counter: counter (4 or more bytes). Malformed frame is skipped.
+func (tag *id3v2Tag) playCounter(frame []byte) error {
+	if len(frame) < 4 {
+		return nil
+	}
+	tag.track.Unprocessed["PLAY_COUNT"] = strconv.FormatUint(id3v2Counter(frame), 10)
+	return nil
+}
+
+// Private frame: owner identifier (ISO-8859-1), binary data. Malformed frame is skipped.
+func (tag *id3v2Tag) private(frame []byte) error {
+	owner, d := id3v2SplitDescription(frame, 0)
+	if owner == "" {
+		return nil
+	}
+	if len(d) > 0 {
+		tag.track.Unprocessed["PRIV:"+owner] = id3v2BinaryValue(d)
+	}
+	return nil
+}
+
+// ID3v2Chapter describes the track chapter of ID3v2 chapter frame addendum (CHAP frame).
+// Start and end times are in milliseconds. The chapter image is the release picture.
+type ID3v2Chapter struct {
+	ID    string             `json:"-"` // element ID
+	Start uint32             `json:"start"`
+	End   uint32             `json:"end"`
+	Title string             `json:"title,omitempty"`
+	URL   string             `json:"url,omitempty"`
+	Image *md.PictureInAudio `json:"-"`
+}
+
+// Table of contents of ID3v2 chapter frame addendum.
+type id3v2TOC struct {
+	ID       string
+	TopLevel bool
+	Ordered  bool
+	Children []string
+	Title    string
+}
+
+// CTOC flags
+const (
+	id3v2TOCTopLevel = 0x01
+	id3v2TOCOrdered  = 0x02
+)
+
+// Chapter: element ID (ISO-8859-1), start time(4), end time(4), start offset(4), end offset(4),
+// sub-frames (TIT2, WXXX, APIC, ...). Malformed frame is skipped.
+// The chapter image is added to the release pictures. Its front cover type is replaced by
+// the illustration one, so the chapter image is not taken for the release cover.
+func (tag *id3v2Tag) chapter(frame []byte) error {
+	id, d := id3v2SplitDescription(frame, 0)
+	if id == "" || len(d) < 16 {
+		return nil
+	}
+	chapter := ID3v2Chapter{
+		ID:    id,
+		Start: encb.BigEndian.Uint32(d),
+		End:   encb.BigEndian.Uint32(d[4:]),
+	}
+	err := id3v2Frames(d[16:], tag.version, 0, func(frameID string, frame []byte) error {
+		switch {
+		case frameID == "TIT2" && len(frame) > 0:
+			chapter.Title = strings.Join(id3v2DecodeStrings(frame[1:], frame[0]), "; ")
+		case frameID == "WXXX" && len(frame) > 0:
+			_, d := id3v2SplitDescription(frame[1:], frame[0])
+			chapter.URL = id3v2URL(d)
+		case frameID == "APIC":
+			chapter.Image = id3v2Picture(frame, tag.version)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+	if chapter.Image != nil {
+		if chapter.Image.PictType == md.PictTypeCoverFront {
+			chapter.Image.PictType = md.PictTypeIllustration
+		}
+		chapter.Image = addPicture(tag.release, chapter.Image)
+	}
+	tag.chapters = append(tag.chapters, &chapter)
+	return nil
+}
+
+// Table of contents: element ID (ISO-8859-1), flags(1), entry count(1), child element IDs,
+// sub-frames (TIT2, ...). Malformed frame is skipped.
+func (tag *id3v2Tag) tableOfContents(frame []byte) error {
+	id, d := id3v2SplitDescription(frame, 0)
+	if id == "" || len(d) < 2 {
+		return nil
+	}
+	toc := id3v2TOC{
+		ID:       id,
+		TopLevel: d[0]&id3v2TOCTopLevel != 0,
+		Ordered:  d[0]&id3v2TOCOrdered != 0,
+	}
+	n := int(d[1])
+	d = d[2:]
+	for i := 0; i < n && len(d) > 0; i++ {
+		var child string
+		child, d = id3v2SplitDescription(d, 0)
+		toc.Children = append(toc.Children, child)
+	}
+	err := id3v2Frames(d, tag.version, 0, func(frameID string, frame []byte) error {
+		if frameID == "TIT2" && len(frame) > 0 {
+			toc.Title = strings.Join(id3v2DecodeStrings(frame[1:], frame[0]), "; ")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+	tag.tocs = append(tag.tocs, &toc)
+	return nil
+}
+
+// Chapters are ordered by the ordered top-level table of contents, other chapters follow
+// in the order of the start time.
+func (tag *id3v2Tag) sortChapters() {
+	sort.SliceStable(tag.chapters, func(i, j int) bool {
+		return tag.chapters[i].Start < tag.chapters[j].Start
+	})
+	order := make(map[string]int)
+	for _, toc := range tag.tocs {
+		if toc.TopLevel && toc.Ordered {
+			tag.tocOrder(toc, order, map[string]bool{})
+		}
+	}
+	sort.SliceStable(tag.chapters, func(i, j int) bool {
+		oi, iok := order[tag.chapters[i].ID]
+		oj, jok := order[tag.chapters[j].ID]
+		return iok && (!jok || oi < oj)
+	})
+}
+
+// Flattens the nested tables of contents into the chapter order.
+func (tag *id3v2Tag) tocOrder(toc *id3v2TOC, order map[string]int, visited map[string]bool) {
+	if visited[toc.ID] {
+		return
+	}
+	visited[toc.ID] = true
+	for _, child := range toc.Children {
+		nested := false
+		for _, t := range tag.tocs {
+			if t.ID == child {
+				tag.tocOrder(t, order, visited)
+				nested = true
+			}
+		}
+		if _, ok := order[child]; !ok && !nested {
+			order[child] = len(order)
+		}
+	}
+}
+
+// Counter is big-endian integer of 4 or more bytes. Too large value is saturated.
+func id3v2Counter(d []byte) uint64 {
+	if len(d) > 8 {
+		return math.MaxUint64
+	}
+	var ret uint64
+	for _, b := range d {
+		ret = ret<<8 | uint64(b)
+	}
+	return ret
+}
+
+// Represents binary data as a string: GUID (i.e. WM/MediaClassPrimaryID), UTF-16LE string
+// (i.e. WM/Provider), printable ASCII string or hex dump.
+func id3v2BinaryValue(d []byte) string {
+	switch {
+	case len(d) == 16 && !id3v2IsPrintable(d):
+		return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}", encb.LittleEndian.Uint32(d),
+			encb.LittleEndian.Uint16(d[4:]), encb.LittleEndian.Uint16(d[6:]), d[8:10], d[10:])
+	case len(d) >= 4 && len(d)%2 == 0 && d[1] == 0 && d[len(d)-2] == 0 && d[len(d)-1] == 0:
+		if s := id3v2Text(d[:id3v2StringEnd(d, 2)], 1); id3v2IsPrintable([]byte(s)) {
+			return s
+		}
+	case id3v2IsPrintable(bytes.TrimRight(d, "\x00")):
+		return string(bytes.TrimRight(d, "\x00"))
+	}
+	return hex.EncodeToString(d)
+}
+
+func id3v2IsPrintable(d []byte) bool {
+	if len(d) == 0 || !utf8.Valid(d) {
+		return false
+	}
+	for _, r := range string(d) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Splits the terminated description of the encoding and the rest of data.
+func id3v2SplitDescription(d []byte, encoding byte) (string, []byte) {
+	end := id3v2StringEnd(d, encoding)
+	descr := id3v2Text(d[:end], encoding)
+	return descr, d[id3v2Min(end+id3v2TerminatorLen(encoding), len(d)):]
+}
+
+// Language is ISO-639-2 code. Returns lowercase code or "" for unknown language ("XXX").
+func id3v2Language(b []byte) string {
+	lang := strings.ToLower(string(b))
+	if lang == "xxx" {
+		return ""
+	}
+	for _, c := range lang {
+		if c < 'a' || c > 'z' {
+			return ""
+		}
+	}
+	return lang
+}
+
+// URL is ISO-8859-1 string, the terminator is optional.
+func id3v2URL(d []byte) string {
+	return latin1String(d[:id3v2StringEnd(d, 0)])
+}
+
+func id3v2Min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
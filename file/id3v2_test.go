@@ -0,0 +1,403 @@
+package file
+
+import (
+	"bytes"
+	"compress/zlib"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+)
+
+// Формирует тег ID3v2.2 из пар "идентификатор фрейма, данные фрейма".
+func id3v22TestTag(frames ...[2]string) []byte {
+	data := new(bytes.Buffer)
+	for _, frame := range frames {
+		n := len(frame[1])
+		data.WriteString(frame[0])
+		data.Write([]byte{byte(n >> 16), byte(n >> 8), byte(n)})
+		data.WriteString(frame[1])
+	}
+	tag := []byte{'I', 'D', '3', 2, 0, 0}
+	tag = append(tag, id3v2TestSize(data.Len())...)
+	return append(tag, data.Bytes()...)
+}
+
+func TestID3v22Metadata(t *testing.T) {
+	d := id3v22TestTag(
+		[2]string{"TT2", "\x00test_track_title"},
+		[2]string{"TAL", "\x00test_album_title"},
+		[2]string{"TRK", "\x003/10"},
+		[2]string{"PIC", "\x00JPG\x03cover\x00\xff\xd8\xff"},
+		[2]string{"TEN", "\x00iTunes v4.6"})
+	r := md.NewRelease()
+	tr := md.NewTrack()
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, r)
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackTitle], "test_track_title")
+	assert.Equal(t, tags[AlbumTitle], "test_album_title")
+	assert.Equal(t, tags[TrackNumber], "3/10")
+	assert.Equal(t, tr.Unprocessed["TENC"], "iTunes v4.6")
+	require.Len(t, r.Pictures, 1)
+	assert.Equal(t, r.Pictures[0].MimeType, "image/jpeg")
+	assert.Equal(t, r.Pictures[0].PictType, md.PictTypeCoverFront)
+	assert.Equal(t, r.Pictures[0].Notes, "cover")
+	assert.Equal(t, r.Pictures[0].Data, []byte{0xff, 0xd8, 0xff})
+}
+
+func TestID3v2VersionNotSupport(t *testing.T) {
+	d := []byte{'I', 'D', '3', 5, 0, 0, 0, 0, 0, 0}
+	_, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), md.NewTrack(), md.NewRelease())
+	assert.ErrorIs(t, err, ErrID3v2VersionNotSupport)
+}
+
+// Формирует фрейм ID3v2.3 (size - обычное целое) или ID3v2.4 (size - synchsafe целое).
+func id3v2TestFrame(version byte, id string, flags byte, data []byte) []byte {
+	ret := []byte(id)
+	if version == 3 {
+		n := len(data)
+		ret = append(ret, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	} else {
+		ret = append(ret, id3v2TestSize(len(data))...)
+	}
+	ret = append(ret, 0, flags)
+	return append(ret, data...)
+}
+
+func id3v2TestHeader(version, flags byte, size int) []byte {
+	return append([]byte{'I', 'D', '3', version, 0, flags}, id3v2TestSize(size)...)
+}
+
+func TestID3v23LargeFrame(t *testing.T) {
+	pict := append([]byte("\x00image/jpeg\x00\x03\x00"), bytes.Repeat([]byte{1}, 300)...)
+	frames := append(id3v2TestFrame(3, "APIC", 0, pict),
+		id3v2TestFrame(3, "TIT2", 0, []byte("\x00test_track_title"))...)
+	// расширенный заголовок: size(4), flags(2), padding size(4)
+	ext := []byte{0, 0, 0, 6, 0, 0, 0, 0, 0, 0}
+	d := append(id3v2TestHeader(3, id3v2FlagExtHeader, len(ext)+len(frames)), ext...)
+	d = append(d, frames...)
+	r := md.NewRelease()
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), md.NewTrack(), r)
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackTitle], "test_track_title")
+	require.Len(t, r.Pictures, 1)
+	assert.Len(t, r.Pictures[0].Data, 300)
+}
+
+func TestID3v23Unsync(t *testing.T) {
+	frames := id3v2TestFrame(3, "TIT2", 0, []byte("\x00a\xff\x00b"))
+	frames = append(frames, id3v2TestFrame(3, "TALB", 0, []byte("\x00test_album_title"))...)
+	d := append(id3v2TestHeader(3, id3v2FlagUnsync, len(frames)), frames...)
+	// заголовок фрейма содержит размер до применения схемы unsynchronisation
+	d[id3v2HeaderSize+7]--
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), md.NewTrack(), md.NewRelease())
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackTitle], "aÿb")
+	assert.Equal(t, tags[AlbumTitle], "test_album_title")
+}
+
+func TestID3v24FrameFlags(t *testing.T) {
+	compressed := new(bytes.Buffer)
+	zw := zlib.NewWriter(compressed)
+	zw.Write([]byte("\x00test_track_title"))
+	zw.Close()
+	// data length indicator(4) + zlib data
+	frame := append(id3v2TestSize(17), compressed.Bytes()...)
+	frames := id3v2TestFrame(4, "TIT2", id3v24FrameCompressed|id3v24FrameDataLength, frame)
+	frames = append(frames, id3v2TestFrame(4, "TALB", id3v24FrameEncrypted, []byte("\x01xxx"))...)
+	frames = append(frames, id3v2TestFrame(4, "TPE1", id3v24FrameGrouping|id3v24FrameUnsync,
+		[]byte("\x01\x00test_artist\xff\x00"))...)
+	d := append(id3v2TestHeader(4, id3v2FlagFooter, len(frames)), frames...)
+	d = append(d, []byte("3DI\x04\x00\x10")...)
+	d = append(d, id3v2TestSize(len(frames))...)
+	d = append(d, 0xff)
+
+	r := binary.NewReader(bytes.NewReader(d))
+	tags, err := ID3v2Metadata(r, md.NewTrack(), md.NewRelease())
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackTitle], "test_track_title")
+	assert.NotContains(t, tags, AlbumTitle)
+	assert.Equal(t, tags[TrackArtist], "test_artistÿ")
+	assert.Equal(t, r.Position(), int64(len(d)-1))
+}
+
+func TestID3v24ITunesFrameSize(t *testing.T) {
+	pict := append([]byte("\x00image/png\x00\x03\x00"), bytes.Repeat([]byte{1}, 200)...)
+	frames := append(id3v2TestFrame(3, "APIC", 0, pict), // plain size
+		id3v2TestFrame(4, "TIT2", 0, []byte("\x00test_track_title"))...)
+	d := append(id3v2TestHeader(4, 0, len(frames)), frames...)
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), md.NewTrack(), md.NewRelease())
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackTitle], "test_track_title")
+}
+
+func TestID3v2DecodeStrings(t *testing.T) {
+	assert.Equal(t, id3v2DecodeStrings([]byte("a\x00b\x00"), 3), []string{"a", "b"})
+	assert.Equal(t, id3v2DecodeStrings([]byte("\xff\xfea\x00\x00\x00\xff\xfeb\x00"), 1), []string{"a", "b"})
+	assert.Equal(t, id3v2DecodeStrings([]byte("\x00a\x00\x00"), 2), []string{"a"})
+	assert.Equal(t, id3v2DecodeStrings([]byte("caf\xe9"), 0), []string{"café"})
+}
+
+func TestID3v24MultiValueFrames(t *testing.T) {
+	d := id3v2TestTag(
+		[2]string{"TPE1", "\x03artist1\x00artist2"},
+		[2]string{"TIPL", "\x03producer\x00test_producer\x00DJ-mix\x00test_dj\x00"},
+		[2]string{"TMCL", "\x03violin\x00test_violinist\x00piano\x00test_pianist"},
+		[2]string{"TSSE", "\x03Lavf58.20.100"},
+		[2]string{"TCON", "\x03Rock\x00Pop"})
+	tr := md.NewTrack()
+	r := md.NewRelease()
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, r)
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackArtist], "artist1; artist2")
+	assert.Equal(t, tr.Unprocessed["TSSE"], "Lavf58.20.100")
+	assert.Equal(t, tags[Producer], "test_producer")
+	assert.Equal(t, tags[MixDJ], "test_dj")
+	require.NoError(t, ProcessTags(tags, r, tr))
+	assert.Equal(t, tr.Record.ActorRoles["test_producer"], []md.ActorRole{"producer"})
+	assert.Equal(t, tr.Record.ActorRoles["test_dj"], []md.ActorRole{"mix-DJ"})
+	assert.Equal(t, tr.Record.ActorRoles["test_violinist"], []md.ActorRole{"violin"})
+	assert.Equal(t, tr.Record.ActorRoles["test_pianist"], []md.ActorRole{"piano"})
+	assert.Equal(t, tr.Record.Genres, []string{"Rock", "Pop"})
+}
+
+func TestID3v23InvolvedPeople(t *testing.T) {
+	frames := id3v2TestFrame(3, "IPLS", 0, []byte("\x00engineer\x00test_engineer\x00"))
+	d := append(id3v2TestHeader(3, 0, len(frames)), frames...)
+	tr := md.NewTrack()
+	r := md.NewRelease()
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, r)
+	require.NoError(t, err)
+	assert.Equal(t, tags[Engineer], "test_engineer")
+	require.NoError(t, ProcessTags(tags, r, tr))
+	assert.Equal(t, tr.Record.ActorRoles["test_engineer"], []md.ActorRole{"engineer"})
+}
+
+func TestID3v24InvolvedPeopleOddCount(t *testing.T) {
+	d := id3v2TestTag([2]string{"TIPL",
+		"\x03producer\x00first_producer\x00guitar\x00test_guitarist\x00producer\x00second_producer\x00mix"})
+	tr := md.NewTrack()
+	r := md.NewRelease()
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, r)
+	require.NoError(t, err)
+	assert.Equal(t, tags[Producer], "first_producer; second_producer")
+	assert.NotContains(t, tags, MixEngineer)
+	assert.NotContains(t, tr.Unprocessed, "TIPL")
+	assert.Equal(t, tr.Record.ActorRoles["test_guitarist"], []md.ActorRole{"guitar"})
+	require.NoError(t, ProcessTags(tags, r, tr))
+	assert.Equal(t, tr.Record.ActorRoles["first_producer"], []md.ActorRole{"producer"})
+	assert.Equal(t, tr.Record.ActorRoles["second_producer"], []md.ActorRole{"producer"})
+}
+
+func TestID3v24Lyrics(t *testing.T) {
+	d := id3v2TestTag(
+		[2]string{"USLT", "\x03engdesc\x00first line\nsecond line"},
+		[2]string{"SYLT", "\x03eng\x02\x01desc\x00first line\x00\x00\x00\x04\xd2" +
+			"\nsecond line\x00\x00\x01\x11\x70"},
+		[2]string{"SYLT", "\x03eng\x02\x05\x00Am\x00\x00\x00\x00\x00"})
+	tr := md.NewTrack()
+	_, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, md.NewRelease())
+	require.NoError(t, err)
+	require.NotNil(t, tr.Composition.Lyrics)
+	assert.Equal(t, tr.Composition.Lyrics.Text, "[00:01.23]first line\n[01:10.00]second line")
+	assert.True(t, tr.Composition.Lyrics.IsSynchronized)
+	assert.Equal(t, tr.Composition.Lyrics.Language, "english")
+	assert.Equal(t, tr.Unprocessed["SYLT:chord"], "[00:00.00]Am")
+}
+
+func TestID3v24TruncatedSyncedLyrics(t *testing.T) {
+	d := id3v2TestTag(
+		[2]string{"SYLT", "\x03eng\x02\x01\x00first line\x00\x00\x00\x04\xd2" +
+			"\nsecond line\x00\x00\x01"},
+		[2]string{"USLT", "\x03en"},
+		[2]string{"TIT2", "\x03test_track_title"})
+	tr := md.NewTrack()
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, md.NewRelease())
+	require.NoError(t, err)
+	require.NotNil(t, tr.Composition.Lyrics)
+	assert.Equal(t, tr.Composition.Lyrics.Text, "[00:01.23]first line")
+	assert.Equal(t, tags[TrackTitle], "test_track_title")
+}
+
+func TestID3v23UnsyncedLyrics(t *testing.T) {
+	frames := id3v2TestFrame(3, "USLT", 0, []byte("\x01deu\xff\xfe\x00\x00\xff\xfeL\x00a\x00"))
+	d := append(id3v2TestHeader(3, 0, len(frames)), frames...)
+	tr := md.NewTrack()
+	_, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, md.NewRelease())
+	require.NoError(t, err)
+	assert.Equal(t, tr.Composition.Lyrics.Text, "La")
+	assert.False(t, tr.Composition.Lyrics.IsSynchronized)
+	assert.Equal(t, tr.Composition.Lyrics.Language, "german")
+}
+
+func TestID3v24UserFrames(t *testing.T) {
+	d := id3v2TestTag(
+		[2]string{"COMM", "\x03eng\x00first comment"},
+		[2]string{"COMM", "\x03rus\x00second comment"},
+		[2]string{"COMM", "\x03engID3v1 Comment\x00first"},
+		[2]string{"COMM", "\x03engiTunNORM\x00 0000044E 00000DC4"},
+		[2]string{"COMM", "\x03engiTunSMPB\x00 00000000 00000210 000003A4 00000000000F4B1C 00000000"},
+		[2]string{"TXXX", ""}, // empty
+		[2]string{"WXXX", ""},
+		[2]string{"TXXX", "\x03CATALOGNUMBER\x00CAT-001"},
+		[2]string{"TXXX", "\x03SOURCE\x00CD\x00Vinyl"},
+		[2]string{"TXXX", "\x03SOURCE\x00Tape"},
+		[2]string{"WXXX", "\x03discogs\x00https://www.discogs.com/release/1"},
+		[2]string{"WOAR", "https://artist.example.com"})
+	tr := md.NewTrack()
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, md.NewRelease())
+	require.NoError(t, err)
+	assert.Equal(t, tags[Comments], "first comment")
+	assert.Equal(t, tr.Unprocessed["COMMENT_LANGUAGE"], "eng")
+	assert.Equal(t, tr.Unprocessed["COMM:rus"], "second comment")
+	assert.Equal(t, tags[CatalogueNumber], "CAT-001")
+	assert.Equal(t, tags[TrackArtistWebPageURL], "https://artist.example.com")
+	assert.Equal(t, tr.Unprocessed["TXXX:SOURCE"], "CD; Vinyl; Tape")
+	assert.Equal(t, tr.Unprocessed["WXXX:discogs"], "https://www.discogs.com/release/1")
+	assert.Equal(t, tr.Unprocessed["ITUNNORM"], "0000044E 00000DC4")
+	assert.Equal(t, tr.Unprocessed["ENCODER_DELAY"], "528")
+	assert.Equal(t, tr.Unprocessed["ENCODER_PADDING"], "932")
+	assert.Equal(t, tr.Unprocessed["SAMPLE_COUNT"], "1002268")
+	assert.NotContains(t, tr.Unprocessed, "COMM:ID3v1 Comment")
+}
+
+func TestID3v24CommentLanguages(t *testing.T) {
+	d := id3v2TestTag(
+		[2]string{"COMM", "\x03engnote\x00the same text"},
+		[2]string{"COMM", "\x03deunote\x00the same text"},
+		[2]string{"COMM", "\x03XXX\x00track notes"},
+		[2]string{"COMM", "\x03en"}, // truncated
+		[2]string{"COMM", "\x03eng\x00english notes"})
+	tr := md.NewTrack()
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, md.NewRelease())
+	require.NoError(t, err)
+	assert.Equal(t, tr.Unprocessed["COMM:eng:note"], "the same text")
+	assert.Equal(t, tr.Unprocessed["COMM:deu:note"], "the same text")
+	assert.Equal(t, tags[Comments], "track notes\nenglish notes")
+	assert.Equal(t, tr.Unprocessed["COMMENT_LANGUAGE"], "eng")
+}
+
+func TestID3v23BinaryFrames(t *testing.T) {
+	var frames []byte
+	for _, frame := range [][2]string{
+		{"UFID", "http://musicbrainz.org\x00f9b7c3a8-c0a8-4d8a-9c59-2b5a0ad3c6d1"},
+		{"UFID", "http://www.cddb.com/id3/taginfo1.html\x003CD3N45Q12345678"},
+		{"POPM", "Windows Media Player 9 Series\x00\xc4\x00\x00\x00\x0c"},
+		{"POPM", "\x00\x01"},
+		{"PCNT", "\x00\x00\x01\x00"},
+		{"PRIV", "WM/MediaClassPrimaryID\x00\xbc\x7d\x60\xd1\x23\xe3\xe2\x4b\x86\xa1\x48\xa4\x2a\x28\x44\x1e"},
+		{"PRIV", "WM/Provider\x00A\x00M\x00G\x00\x00\x00"},
+		{"PRIV", "XMP\x00\x01\x02\x03"},
+	} {
+		frames = append(frames, id3v2TestFrame(3, frame[0], 0, []byte(frame[1]))...)
+	}
+	d := append(id3v2TestHeader(3, 0, len(frames)), frames...)
+	tr := md.NewTrack()
+	_, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, md.NewRelease())
+	require.NoError(t, err)
+	assert.Equal(t, tr.Record.IDs[md.MusicbrainzRecordingID], "f9b7c3a8-c0a8-4d8a-9c59-2b5a0ad3c6d1")
+	assert.Equal(t, tr.IDs["http://www.cddb.com/id3/taginfo1.html"], "3CD3N45Q12345678")
+	assert.Equal(t, tr.Unprocessed["POPM:Windows Media Player 9 Series:RATING"], "196")
+	assert.Equal(t, tr.Unprocessed["POPM:Windows Media Player 9 Series:PLAY_COUNT"], "12")
+	assert.Equal(t, tr.Unprocessed["POPM:RATING"], "1")
+	assert.NotContains(t, tr.Unprocessed, "POPM:PLAY_COUNT")
+	assert.Equal(t, tr.Unprocessed["PLAY_COUNT"], "256")
+	assert.Equal(t, tr.Unprocessed["PRIV:WM/MediaClassPrimaryID"], "{D1607DBC-E323-4BE2-86A1-48A42A28441E}")
+	assert.Equal(t, tr.Unprocessed["PRIV:WM/Provider"], "AMG")
+	assert.Equal(t, tr.Unprocessed["PRIV:XMP"], "010203")
+}
+
+func TestID3v23MalformedBinaryFrames(t *testing.T) {
+	var frames []byte
+	for _, frame := range [][2]string{
+		{"UFID", "http://www.cddb.com/id3/taginfo1.html\x00"},
+		{"UFID", "http://musicbrainz.org\x00f9b7c3a8-c0a8-4d8a-9c59-2b5a0ad3c6d1"},
+		{"POPM", "user@example.com\x00"},
+		{"PCNT", "\x01\x00"},
+		{"PRIV", "\x00\x01\x02"},
+		{"PRIV", "XMP\x00\x01\x02\x03"},
+		{"TIT2", "\x00test_track_title"},
+	} {
+		frames = append(frames, id3v2TestFrame(3, frame[0], 0, []byte(frame[1]))...)
+	}
+	d := append(id3v2TestHeader(3, 0, len(frames)), frames...)
+	tr := md.NewTrack()
+	tags, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), tr, md.NewRelease())
+	require.NoError(t, err)
+	assert.Equal(t, tr.Record.IDs[md.MusicbrainzRecordingID], "f9b7c3a8-c0a8-4d8a-9c59-2b5a0ad3c6d1")
+	assert.NotContains(t, tr.IDs, "http://www.cddb.com/id3/taginfo1.html")
+	assert.NotContains(t, tr.Unprocessed, "POPM:user@example.com:RATING")
+	assert.NotContains(t, tr.Unprocessed, "PLAY_COUNT")
+	assert.Equal(t, tr.Unprocessed["PRIV:XMP"], "010203")
+	assert.Equal(t, tags[TrackTitle], "test_track_title")
+}
+
+func TestID3v24Chapters(t *testing.T) {
+	chap := func(id string, start, end byte, subFrames ...[]byte) []byte {
+		d := append([]byte(id+"\x00"), 0, 0, 0, start, 0, 0, 0, end)
+		d = append(d, bytes.Repeat([]byte{0xff}, 8)...) // offsets are not used
+		for _, sub := range subFrames {
+			d = append(d, sub...)
+		}
+		return id3v2TestFrame(4, "CHAP", 0, d)
+	}
+	trackTag := func(n byte) []byte {
+		frames := id3v2TestFrame(4, "APIC", 0, []byte("\x00image/jpeg\x00\x03\x00\xff\xd8\x01"))
+		frames = append(frames, id3v2TestFrame(4, "APIC", 0, []byte("\x00image/jpeg\x00\x04\x00\xff\xd8\x02"))...)
+		frames = append(frames, chap("ch2", 100, 200,
+			id3v2TestFrame(4, "TIT2", 0, []byte("\x03second")),
+			id3v2TestFrame(4, "APIC", 0, []byte{0, 'i', 'm', 'a', 'g', 'e', '/', 'p', 'n', 'g', 0, 3, 0, 0x89, 'P', n}))...)
+		frames = append(frames, chap("ch1", 0, 100,
+			id3v2TestFrame(4, "TIT2", 0, []byte("\x03first")),
+			id3v2TestFrame(4, "WXXX", 0, []byte("\x03\x00https://example.com/1")))...)
+		frames = append(frames, chap("ch3", 50, 60)...)
+		frames = append(frames, id3v2TestFrame(4, "CHAP", 0, []byte("ch4\x00\x00\x01"))...) // truncated
+		frames = append(frames, chap("ch5", 0, 10, []byte("TIT2\x00\x00\x7f\x7f\x00\x00"))...)
+		frames = append(frames, id3v2TestFrame(4, "CTOC", 0, []byte("toc2\x00"))...)
+		frames = append(frames, id3v2TestFrame(4, "CTOC", 0, append(
+			[]byte("toc\x00\x03\x02ch2\x00ch1\x00"),
+			id3v2TestFrame(4, "TIT2", 0, []byte("\x03contents"))...))...)
+		return append(id3v2TestHeader(4, 0, len(frames)), frames...)
+	}
+	r := md.NewRelease()
+	for _, n := range []byte{'1', '2'} {
+		tag, err := id3v2Metadata(binary.NewReader(bytes.NewReader(trackTag(n))), md.NewTrack(), r)
+		require.NoError(t, err)
+		require.Len(t, tag.chapters, 3)
+		chapters := tag.chapters
+		assert.Equal(t, chapters[0].Title, "second")
+		assert.Equal(t, [2]uint32{chapters[0].Start, chapters[0].End}, [2]uint32{100, 200})
+		require.NotNil(t, chapters[0].Image)
+		assert.Contains(t, r.Pictures, chapters[0].Image)
+		assert.Equal(t, chapters[0].Image.Data, []byte{0x89, 'P', n})
+		assert.Equal(t, chapters[0].Image.PictType, md.PictTypeIllustration)
+		assert.Equal(t, chapters[1].Title, "first")
+		assert.Equal(t, chapters[1].URL, "https://example.com/1")
+		assert.Nil(t, chapters[1].Image)
+		assert.Equal(t, chapters[2].Start, uint32(50))
+		assert.Empty(t, chapters[2].Title)
+	}
+	assert.Len(t, r.Pictures, 4) // the same cover and back cover of both tracks
+	require.NotNil(t, r.Cover())
+	assert.Equal(t, r.Cover().Data, []byte{0xff, 0xd8, 0x01})
+}
+
+func TestID3v24Pictures(t *testing.T) {
+	d := id3v2TestTag(
+		[2]string{"APIC", "\x00image/jpeg\x00\x03\x00\xff\xd8\x01"},
+		[2]string{"APIC", "\x03image/jpeg\x00\x04back\x00\xff\xd8\x02"},
+		[2]string{"APIC", "\x00image/jpeg\x00\x05\x00\xff\xd8\x03"})
+	r := md.NewRelease()
+	for i := 0; i < 2; i++ { // the same pictures of two tracks
+		_, err := ID3v2Metadata(binary.NewReader(bytes.NewReader(d)), md.NewTrack(), r)
+		require.NoError(t, err)
+	}
+	require.Len(t, r.Pictures, 3)
+	assert.Equal(t, r.Pictures[0].PictType, md.PictTypeCoverFront)
+	assert.Equal(t, r.Pictures[1].PictType, md.PictTypeCoverBack)
+	assert.Equal(t, r.Pictures[1].Notes, "back")
+	assert.Equal(t, r.Pictures[2].PictType, md.PictTypeLeaflet)
+	assert.Equal(t, r.Pictures[2].Data, []byte{0xff, 0xd8, 0x03})
+}
@@ -0,0 +1,478 @@
+// Matroska/WebM audio processing module.
+// Specification links: https://www.matroska.org/technical/elements.html
+// https://www.matroska.org/technical/tagging.html
+// https://www.matroska.org/technical/attachments.html
+
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+	intutils "github.com/ytsiuryn/go-intutils"
+)
+
+// EBML element IDs (with the length marker).
+const (
+	ebmlHeaderID          = 0x1a45dfa3
+	ebmlDocTypeID         = 0x4282
+	mkaSegmentID          = 0x18538067
+	mkaInfoID             = 0x1549a966
+	mkaTimecodeScaleID    = 0x2ad7b1
+	mkaDurationID         = 0x4489
+	mkaTracksID           = 0x1654ae6b
+	mkaTrackEntryID       = 0xae
+	mkaTrackUIDID         = 0x73c5
+	mkaTrackTypeID        = 0x83
+	mkaCodecID            = 0x86
+	mkaAudioID            = 0xe1
+	mkaSamplingFreqID     = 0xb5
+	mkaOutputSamplingID   = 0x78b5
+	mkaChannelsID         = 0x9f
+	mkaBitDepthID         = 0x6264
+	mkaClusterID          = 0x1f43b675
+	mkaTagsID             = 0x1254c367
+	mkaTagID              = 0x7373
+	mkaTargetsID          = 0x63c0
+	mkaTargetTypeValueID  = 0x68ca
+	mkaTagTrackUIDID      = 0x63c5
+	mkaSimpleTagID        = 0x67c8
+	mkaTagNameID          = 0x45a3
+	mkaTagStringID        = 0x4487
+	mkaAttachmentsID      = 0x1941a469
+	mkaAttachedFileID     = 0x61a7
+	mkaFileDescriptionID  = 0x467e
+	mkaFileNameID         = 0x466e
+	mkaFileMimeTypeID     = 0x4660
+	mkaFileDataID         = 0x465c
+	mkaTrackTypeAudio     = 2
+	mkaDefaultTimecode    = 1000000 // ns
+	mkaTargetTrack        = 30
+	mkaTargetAlbum        = 50
+	mkaCodecKey           = "MATROSKA_CODEC"
+	ebmlMaxElementHeader  = 12
+	ebmlUnknownSizeMarker = -1
+)
+
+// Public errors
+var (
+	ErrMKANoSign           = errors.New("has no Matroska EBML header")
+	ErrMKAIncorrectElement = errors.New("incorrect EBML element")
+	ErrMKANoSegment        = errors.New("has no Matroska segment")
+	ErrMKANoAudioTrack     = errors.New("has no Matroska audio track")
+)
+
+// MKAAlbumTags describes the SimpleTag names which meaning differs at the album
+// level (TargetTypeValue 50). Other names are mapped with Matroska scheme.
+// TOTAL_PARTS of the album is the number of its tracks.
+var MKAAlbumTags = map[TagName]TagKey{
+	"TITLE":       AlbumTitle,
+	"ARTIST":      AlbumArtist,
+	"TOTAL_PARTS": TrackTotal,
+}
+
+// Album level SimpleTag names which are ignored: PART_NUMBER is the album number
+// in the upper level (edition, volume) and not the track position.
+var mkaIgnoredAlbumTags = map[TagName]bool{
+	"PART_NUMBER": true,
+}
+
+type ebmlElement struct {
+	ID   uint32
+	Data []byte
+}
+
+// Mka is type for Matroska/WebM audio files processing.
+type Mka struct {
+	*md.Track
+	release *md.Release
+	r       *binary.Reader
+}
+
+// TrackMetadata gatheres metadata info for Matroska/WebM file
+func (mka *Mka) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
+	mka.release = release
+	mka.Track = track
+	mka.r = binary.NewReader(f)
+	end := mka.r.SeekBytes(0, io.SeekEnd)
+	id, size, pos, err := mka.elementHeader(0, end)
+	if err != nil || id != ebmlHeaderID || size < 0 || pos+size > end {
+		return ErrMKANoSign
+	}
+	if err = mka.ebmlHeader(mka.r.ReadBytes(size)); err != nil {
+		return err
+	}
+	if id, size, pos, err = mka.elementHeader(pos+size, end); err != nil {
+		return err
+	}
+	if id != mkaSegmentID {
+		return ErrMKANoSegment
+	}
+	segmentEnd := end
+	if size != ebmlUnknownSizeMarker && pos+size < end {
+		segmentEnd = pos + size
+	}
+	var audioUID uint64
+	var audioFound bool
+	var tags [][]byte
+	for pos < segmentEnd {
+		if id, size, pos, err = mka.elementHeader(pos, segmentEnd); err != nil {
+			return err
+		}
+		if id == mkaClusterID && (size == ebmlUnknownSizeMarker || pos+size > segmentEnd) {
+			break // live stream or truncated file
+		}
+		if size == ebmlUnknownSizeMarker || pos+size > segmentEnd {
+			return ErrMKAIncorrectElement
+		}
+		switch id {
+		case mkaInfoID:
+			err = mka.info(mka.r.ReadBytes(size))
+		case mkaTracksID:
+			if !audioFound {
+				audioUID, audioFound, err = mka.tracks(mka.r.ReadBytes(size))
+			}
+		case mkaTagsID:
+			tags = append(tags, append([]byte{}, mka.r.ReadBytes(size)...))
+		case mkaAttachmentsID:
+			err = mka.attachments(mka.r.ReadBytes(size))
+		}
+		if err != nil {
+			return err
+		}
+		pos += size
+	}
+	if !audioFound {
+		return ErrMKANoAudioTrack
+	}
+	if mka.Duration > 0 {
+		mka.AudioInfo.AvgBitrate = int(
+			math.Round(8 * float64(mka.FileInfo.FileSize) / float64(mka.Duration)))
+	}
+	trackTags := make(map[TagKey]string)
+	albumTags := make(map[TagKey]string)
+	for _, d := range tags {
+		if err = mka.tags(d, audioUID, trackTags, albumTags); err != nil {
+			return err
+		}
+	}
+	// значения уровня трека уточняют значения уровня альбома
+	if err = ProcessTags(mergeTags(albumTags, trackTags), release, track); err != nil {
+		return err
+	}
+	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	return nil
+}
+
+// Reads the element ID and data size at the position. Returns them with the data position.
+func (mka *Mka) elementHeader(pos, end int64) (uint32, int64, int64, error) {
+	n := end - pos
+	if n < 2 {
+		return 0, 0, 0, ErrMKAIncorrectElement
+	}
+	if n > ebmlMaxElementHeader {
+		n = ebmlMaxElementHeader
+	}
+	mka.r.SeekBytes(pos, io.SeekStart)
+	d := mka.r.CheckBytes(n)
+	id, idLen := ebmlVint(d, true)
+	if idLen == 0 || idLen > 4 {
+		return 0, 0, 0, ErrMKAIncorrectElement
+	}
+	size, sizeLen := ebmlVint(d[idLen:], false)
+	if sizeLen == 0 {
+		return 0, 0, 0, ErrMKAIncorrectElement
+	}
+	dataSize := int64(size)
+	if size == 1<<(7*sizeLen)-1 {
+		dataSize = ebmlUnknownSizeMarker
+	} else if dataSize < 0 {
+		return 0, 0, 0, ErrMKAIncorrectElement
+	}
+	pos = mka.r.SkipBytes(int64(idLen + sizeLen))
+	return uint32(id), dataSize, pos, nil
+}
+
+// EBML header must declare "matroska" or "webm" document type.
+func (mka *Mka) ebmlHeader(d []byte) error {
+	elements, err := ebmlElements(d)
+	if err != nil {
+		return err
+	}
+	docType := ebmlChild(elements, ebmlDocTypeID)
+	if docType == nil {
+		return ErrMKANoSign
+	}
+	if dt := ebmlString(docType.Data); dt != "matroska" && dt != "webm" {
+		return ErrMKANoSign
+	}
+	return nil
+}
+
+// Segment information: timecode scale(ns) and duration in timecode scale units.
+func (mka *Mka) info(d []byte) error {
+	elements, err := ebmlElements(d)
+	if err != nil {
+		return err
+	}
+	scale := uint64(mkaDefaultTimecode)
+	if e := ebmlChild(elements, mkaTimecodeScaleID); e != nil {
+		scale = ebmlUint(e.Data)
+	}
+	if e := ebmlChild(elements, mkaDurationID); e != nil {
+		mka.Duration = intutils.Duration(math.Round(ebmlFloat(e.Data) * float64(scale) / 1e6))
+	}
+	return nil
+}
+
+// Processing of the first audio track entry. Returns its UID and true if it is found.
+func (mka *Mka) tracks(d []byte) (uint64, bool, error) {
+	elements, err := ebmlElements(d)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, entry := range ebmlChildren(elements, mkaTrackEntryID) {
+		fields, err := ebmlElements(entry.Data)
+		if err != nil {
+			return 0, false, err
+		}
+		if e := ebmlChild(fields, mkaTrackTypeID); e == nil || ebmlUint(e.Data) != mkaTrackTypeAudio {
+			continue
+		}
+		var uid uint64
+		if e := ebmlChild(fields, mkaTrackUIDID); e != nil {
+			uid = ebmlUint(e.Data)
+		}
+		if e := ebmlChild(fields, mkaCodecID); e != nil {
+			mka.Unprocessed[mkaCodecKey] = ebmlString(e.Data)
+		}
+		if e := ebmlChild(fields, mkaAudioID); e != nil {
+			if err = mka.audio(e.Data); err != nil {
+				return 0, false, err
+			}
+		}
+		return uid, true, nil
+	}
+	return 0, false, nil
+}
+
+// Audio settings: sampling frequency, output sampling frequency (SBR), channels, bit depth.
+func (mka *Mka) audio(d []byte) error {
+	elements, err := ebmlElements(d)
+	if err != nil {
+		return err
+	}
+	mka.AudioInfo.Samplerate = 8000
+	if e := ebmlChild(elements, mkaSamplingFreqID); e != nil {
+		mka.AudioInfo.Samplerate = int(math.Round(ebmlFloat(e.Data)))
+	}
+	if e := ebmlChild(elements, mkaOutputSamplingID); e != nil {
+		mka.AudioInfo.Samplerate = int(math.Round(ebmlFloat(e.Data)))
+	}
+	mka.AudioInfo.Channels = 1
+	if e := ebmlChild(elements, mkaChannelsID); e != nil {
+		mka.AudioInfo.Channels = int(ebmlUint(e.Data))
+	}
+	if e := ebmlChild(elements, mkaBitDepthID); e != nil {
+		mka.AudioInfo.SampleSize = int(ebmlUint(e.Data))
+	}
+	return nil
+}
+
+// Tags element: Tag elements with Targets and SimpleTag (name, string value) elements.
+// Tags for other tracks and target levels except track and album are ignored.
+func (mka *Mka) tags(d []byte, audioUID uint64, trackTags, albumTags map[TagKey]string) error {
+	elements, err := ebmlElements(d)
+	if err != nil {
+		return err
+	}
+	for _, tag := range ebmlChildren(elements, mkaTagID) {
+		fields, err := ebmlElements(tag.Data)
+		if err != nil {
+			return err
+		}
+		level := uint64(mkaTargetAlbum)
+		if targets := ebmlChild(fields, mkaTargetsID); targets != nil {
+			targetFields, err := ebmlElements(targets.Data)
+			if err != nil {
+				return err
+			}
+			if e := ebmlChild(targetFields, mkaTargetTypeValueID); e != nil {
+				level = ebmlUint(e.Data)
+			}
+			if e := ebmlChild(targetFields, mkaTagTrackUIDID); e != nil {
+				if uid := ebmlUint(e.Data); uid != 0 && uid != audioUID {
+					continue
+				}
+			}
+		}
+		var processedTags map[TagKey]string
+		switch level {
+		case mkaTargetTrack:
+			processedTags = trackTags
+		case mkaTargetAlbum:
+			processedTags = albumTags
+		default:
+			continue
+		}
+		for _, simpleTag := range ebmlChildren(fields, mkaSimpleTagID) {
+			if err = mka.simpleTag(simpleTag.Data, level, processedTags); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (mka *Mka) simpleTag(d []byte, level uint64, processedTags map[TagKey]string) error {
+	elements, err := ebmlElements(d)
+	if err != nil {
+		return err
+	}
+	name, val := ebmlChild(elements, mkaTagNameID), ebmlChild(elements, mkaTagStringID)
+	if name == nil || val == nil { // binary values are not supported
+		return nil
+	}
+	tagName := strings.ToUpper(ebmlString(name.Data))
+	tagVal := strings.TrimSpace(ebmlString(val.Data))
+	if level == mkaTargetAlbum && mkaIgnoredAlbumTags[tagName] {
+		return nil
+	}
+	if tag, ok := MKAAlbumTags[tagName]; ok && level == mkaTargetAlbum {
+		processedTags[tag] = tagVal
+	} else if tag, ok := SchemaTagToUniKey[Matroska][tagName]; ok {
+		processedTags[tag] = tagVal
+	} else {
+		mka.Unprocessed[tagName] = tagVal
+	}
+	return nil
+}
+
+// Attachments: attached files with description, name, mime type and data.
+// Images named "cover.*" (including "cover_land.*") are front covers, "small_cover.*"
+// ones are icons.
+func (mka *Mka) attachments(d []byte) error {
+	elements, err := ebmlElements(d)
+	if err != nil {
+		return err
+	}
+	for _, file := range ebmlChildren(elements, mkaAttachedFileID) {
+		fields, err := ebmlElements(file.Data)
+		if err != nil {
+			return err
+		}
+		mime, data := ebmlChild(fields, mkaFileMimeTypeID), ebmlChild(fields, mkaFileDataID)
+		if mime == nil || data == nil {
+			continue
+		}
+		mimeType := ebmlString(mime.Data)
+		if mimeType != "image/jpeg" && mimeType != "image/png" {
+			continue
+		}
+		pict := md.PictureInAudio{PictureMetadata: &md.PictureMetadata{MimeType: mimeType}}
+		if name := ebmlChild(fields, mkaFileNameID); name != nil {
+			fn := strings.ToLower(ebmlString(name.Data))
+			if strings.HasPrefix(fn, "cover") {
+				pict.PictType = md.PictTypeCoverFront
+			} else if strings.HasPrefix(fn, "small_cover") {
+				pict.PictType = md.PictTypeOtherIcon
+			}
+		}
+		if descr := ebmlChild(fields, mkaFileDescriptionID); descr != nil {
+			pict.Notes = ebmlString(descr.Data)
+		}
+		pict.Size = uint32(len(data.Data))
+		pict.Data = append([]byte{}, data.Data...)
+		addPicture(mka.release, &pict)
+	}
+	return nil
+}
+
+// Splits the data into a sequence of EBML elements.
+func ebmlElements(d []byte) ([]ebmlElement, error) {
+	var elements []ebmlElement
+	for pos := 0; pos < len(d); {
+		id, idLen := ebmlVint(d[pos:], true)
+		if idLen == 0 || idLen > 4 {
+			return nil, ErrMKAIncorrectElement
+		}
+		pos += idLen
+		size, sizeLen := ebmlVint(d[pos:], false)
+		pos += sizeLen
+		if sizeLen == 0 || size > uint64(len(d)-pos) {
+			return nil, ErrMKAIncorrectElement
+		}
+		elements = append(elements, ebmlElement{uint32(id), d[pos : pos+int(size)]})
+		pos += int(size)
+	}
+	return elements, nil
+}
+
+func ebmlChild(elements []ebmlElement, id uint32) *ebmlElement {
+	for i := range elements {
+		if elements[i].ID == id {
+			return &elements[i]
+		}
+	}
+	return nil
+}
+
+func ebmlChildren(elements []ebmlElement, id uint32) []ebmlElement {
+	var ret []ebmlElement
+	for _, e := range elements {
+		if e.ID == id {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// Decodes EBML variable size integer: the count of leading zero bits of the first byte
+// defines the length. The length marker is kept for element IDs.
+// Returns the value and its size in bytes (0 on error).
+func ebmlVint(d []byte, keepMarker bool) (uint64, int) {
+	if len(d) == 0 || d[0] == 0 {
+		return 0, 0
+	}
+	n := bits.LeadingZeros8(d[0]) + 1
+	if n > len(d) {
+		return 0, 0
+	}
+	ret := uint64(d[0])
+	if !keepMarker {
+		ret &= 0xff >> n
+	}
+	for _, b := range d[1:n] {
+		ret = ret<<8 | uint64(b)
+	}
+	return ret, n
+}
+
+func ebmlUint(d []byte) uint64 {
+	var ret uint64
+	for _, b := range d {
+		ret = ret<<8 | uint64(b)
+	}
+	return ret
+}
+
+func ebmlFloat(d []byte) float64 {
+	switch len(d) {
+	case 4:
+		return float64(math.Float32frombits(encb.BigEndian.Uint32(d)))
+	case 8:
+		return math.Float64frombits(encb.BigEndian.Uint64(d))
+	}
+	return 0
+}
+
+func ebmlString(d []byte) string {
+	return string(bytes.TrimRight(d, "\x00"))
+}
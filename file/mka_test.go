@@ -0,0 +1,132 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+// Формирует EBML элемент с 8-байтовым полем размера.
+func ebmlTestElement(id uint32, data ...[]byte) []byte {
+	var ret []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(ret) > 0 {
+			ret = append(ret, b)
+		}
+	}
+	payload := bytes.Join(data, nil)
+	size := make([]byte, 8)
+	encb.BigEndian.PutUint64(size, uint64(len(payload)))
+	size[0] = 1
+	return append(append(ret, size...), payload...)
+}
+
+func ebmlTestSimpleTag(name, val string) []byte {
+	return ebmlTestElement(mkaSimpleTagID,
+		ebmlTestElement(mkaTagNameID, []byte(name)),
+		ebmlTestElement(mkaTagStringID, []byte(val)))
+}
+
+func TestEbmlVint(t *testing.T) {
+	v, n := ebmlVint([]byte{0x40, 0x02}, false)
+	assert.Equal(t, v, uint64(2))
+	assert.Equal(t, n, 2)
+	v, n = ebmlVint([]byte{0x1a, 0x45, 0xdf, 0xa3}, true)
+	assert.Equal(t, v, uint64(ebmlHeaderID))
+	assert.Equal(t, n, 4)
+	_, n = ebmlVint([]byte{0x20, 0x01}, false)
+	assert.Zero(t, n)
+}
+
+func TestMkaTrackMetadata(t *testing.T) {
+	duration := make([]byte, 8)
+	encb.BigEndian.PutUint64(duration, math.Float64bits(3000))
+	samplerate := make([]byte, 8)
+	encb.BigEndian.PutUint64(samplerate, math.Float64bits(48000))
+	d := ebmlTestElement(ebmlHeaderID, ebmlTestElement(ebmlDocTypeID, []byte("matroska")))
+	d = append(d, ebmlTestElement(mkaSegmentID,
+		ebmlTestElement(mkaInfoID,
+			ebmlTestElement(mkaTimecodeScaleID, []byte{0x0f, 0x42, 0x40}),
+			ebmlTestElement(mkaDurationID, duration)),
+		ebmlTestElement(mkaTracksID,
+			ebmlTestElement(mkaTrackEntryID,
+				ebmlTestElement(mkaTrackUIDID, []byte{7}),
+				ebmlTestElement(mkaTrackTypeID, []byte{mkaTrackTypeAudio}),
+				ebmlTestElement(mkaCodecID, []byte("A_FLAC")),
+				ebmlTestElement(mkaAudioID,
+					ebmlTestElement(mkaSamplingFreqID, samplerate),
+					ebmlTestElement(mkaChannelsID, []byte{2}),
+					ebmlTestElement(mkaBitDepthID, []byte{24})))),
+		ebmlTestElement(mkaClusterID, make([]byte, 100)),
+		ebmlTestElement(mkaTagsID,
+			ebmlTestElement(mkaTagID,
+				ebmlTestElement(mkaTargetsID, ebmlTestElement(mkaTargetTypeValueID, []byte{50})),
+				ebmlTestSimpleTag("TITLE", "test_album_title"),
+				ebmlTestSimpleTag("ARTIST", "test_album_artist"),
+				ebmlTestSimpleTag("TOTAL_PARTS", "10")),
+			ebmlTestElement(mkaTagID,
+				ebmlTestElement(mkaTargetsID,
+					ebmlTestElement(mkaTargetTypeValueID, []byte{30}),
+					ebmlTestElement(mkaTagTrackUIDID, []byte{7})),
+				ebmlTestSimpleTag("TITLE", "test_track_title"),
+				ebmlTestSimpleTag("PART_NUMBER", "3"),
+				ebmlTestSimpleTag("ENCODER", "test_encoder")),
+			ebmlTestElement(mkaTagID,
+				ebmlTestElement(mkaTargetsID,
+					ebmlTestElement(mkaTargetTypeValueID, []byte{30}),
+					ebmlTestElement(mkaTagTrackUIDID, []byte{8})),
+				ebmlTestSimpleTag("TITLE", "other_track_title"))),
+		ebmlTestElement(mkaAttachmentsID,
+			ebmlTestElement(mkaAttachedFileID,
+				ebmlTestElement(mkaFileNameID, []byte("cover.jpg")),
+				ebmlTestElement(mkaFileMimeTypeID, []byte("image/jpeg")),
+				ebmlTestElement(mkaFileDataID, []byte{0xff, 0xd8, 0xff})),
+			ebmlTestElement(mkaAttachedFileID,
+				ebmlTestElement(mkaFileNameID, []byte("notes.txt")),
+				ebmlTestElement(mkaFileMimeTypeID, []byte("text/plain")),
+				ebmlTestElement(mkaFileDataID, []byte("text")))))...)
+
+	r := md.NewRelease()
+	tr := md.NewTrack()
+	tr.FileInfo.FileSize = int64(len(d))
+	require.NoError(t, new(Mka).TrackMetadata(bytes.NewReader(d), r, tr))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 48000)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, tr.AudioInfo.SampleSize, 24)
+	assert.Equal(t, int64(tr.Duration), int64(3000))
+	assert.Equal(t, tr.Unprocessed[mkaCodecKey], "A_FLAC")
+	assert.Equal(t, tr.Unprocessed["ENCODER"], "test_encoder")
+	assert.Equal(t, tr.Title, "test_track_title")
+	assert.Equal(t, tr.Position, "03")
+	assert.Equal(t, r.Title, "test_album_title")
+	assert.Equal(t, r.TotalTracks, 10)
+	require.Len(t, r.Pictures, 1)
+	assert.Equal(t, r.Pictures[0].PictType, md.PictTypeCoverFront)
+	assert.Equal(t, r.Pictures[0].MimeType, "image/jpeg")
+}
+
+func TestMkaAlbumPartNumber(t *testing.T) {
+	mka := Mka{Track: md.NewTrack()}
+	tags := make(map[TagKey]string)
+	for _, tag := range [][]byte{
+		ebmlTestSimpleTag("PART_NUMBER", "2"),
+		ebmlTestSimpleTag("TOTAL_PARTS", "10"),
+	} {
+		elements, err := ebmlElements(tag)
+		require.NoError(t, err)
+		require.NoError(t, mka.simpleTag(elements[0].Data, mkaTargetAlbum, tags))
+	}
+	assert.Equal(t, tags, map[TagKey]string{TrackTotal: "10"})
+	assert.NotContains(t, mka.Unprocessed, "PART_NUMBER")
+}
+
+func TestMkaNoSign(t *testing.T) {
+	d := ebmlTestElement(ebmlHeaderID, ebmlTestElement(ebmlDocTypeID, []byte("other")))
+	err := new(Mka).TrackMetadata(bytes.NewReader(d), md.NewRelease(), md.NewTrack())
+	assert.ErrorIs(t, err, ErrMKANoSign)
+}
@@ -5,8 +5,10 @@
 package file
 
 import (
+	encb "encoding/binary"
 	"errors"
 	"io"
+	"math"
 
 	md "github.com/ytsiuryn/ds-audiomd"
 	binary "github.com/ytsiuryn/go-binary"
@@ -19,19 +21,17 @@ type Bitrate = int
 // SamplingRate ..
 type SamplingRate = int
 
-// ErrMP3Ver25NotSupport ..
-var ErrMP3Ver25NotSupport = errors.New("MPEG2.5 is not supported yet")
-
 // ErrMP3WrongSyncWord ..
 var ErrMP3WrongSyncWord = errors.New("wrong synchronization word")
 
 // MPEGVersion defines MPEG version
 type MPEGVersion byte
 
-// MPEG version (MPEG2.5 is omitted)
+// MPEG version
 const (
 	MPEG2 MPEGVersion = iota
 	MPEG1
+	MPEG25 // unofficial extension of MPEG2 for the low samplerates
 )
 
 // LayerType defines Layer type
@@ -45,7 +45,7 @@ const (
 	Layer1
 )
 
-// BitrateMap defines existing bitrates
+// BitrateMap defines existing bitrates. Bitrate index 0 means free format.
 var BitrateMap = map[MPEGVersion]map[LayerType]map[byte]Bitrate{
 	MPEG1: {
 		Layer1: {
@@ -100,21 +100,55 @@ var BitrateMap = map[MPEGVersion]map[LayerType]map[byte]Bitrate{
 	MPEG2: {
 		Layer1: {
 			1:  32,
-			2:  64,
-			3:  96,
-			4:  128,
-			5:  160,
-			6:  192,
-			7:  224,
-			8:  256,
-			9:  288,
-			10: 320,
-			11: 352,
-			12: 384,
-			13: 416,
-			14: 448,
+			2:  48,
+			3:  56,
+			4:  64,
+			5:  80,
+			6:  96,
+			7:  112,
+			8:  128,
+			9:  144,
+			10: 160,
+			11: 176,
+			12: 192,
+			13: 224,
+			14: 256,
 		},
 		Layer2: {
+			1:  8,
+			2:  16,
+			3:  24,
+			4:  32,
+			5:  40,
+			6:  48,
+			7:  56,
+			8:  64,
+			9:  80,
+			10: 96,
+			11: 112,
+			12: 128,
+			13: 144,
+			14: 160,
+		},
+		Layer3: {
+			1:  8,
+			2:  16,
+			3:  24,
+			4:  32,
+			5:  40,
+			6:  48,
+			7:  56,
+			8:  64,
+			9:  80,
+			10: 96,
+			11: 112,
+			12: 128,
+			13: 144,
+			14: 160,
+		},
+	},
+	MPEG25: {
+		Layer1: {
 			1:  32,
 			2:  48,
 			3:  56,
@@ -123,28 +157,44 @@ var BitrateMap = map[MPEGVersion]map[LayerType]map[byte]Bitrate{
 			6:  96,
 			7:  112,
 			8:  128,
-			9:  160,
-			10: 192,
-			11: 224,
-			12: 256,
-			13: 320,
-			14: 384,
+			9:  144,
+			10: 160,
+			11: 176,
+			12: 192,
+			13: 224,
+			14: 256,
+		},
+		Layer2: {
+			1:  8,
+			2:  16,
+			3:  24,
+			4:  32,
+			5:  40,
+			6:  48,
+			7:  56,
+			8:  64,
+			9:  80,
+			10: 96,
+			11: 112,
+			12: 128,
+			13: 144,
+			14: 160,
 		},
 		Layer3: {
 			1:  8,
 			2:  16,
 			3:  24,
 			4:  32,
-			5:  64,
-			6:  80,
+			5:  40,
+			6:  48,
 			7:  56,
 			8:  64,
-			9:  128,
-			10: 160,
+			9:  80,
+			10: 96,
 			11: 112,
 			12: 128,
-			13: 256,
-			14: 320,
+			13: 144,
+			14: 160,
 		},
 	},
 }
@@ -161,61 +211,300 @@ var FrequencyMap = map[MPEGVersion]map[byte]SamplingRate{
 		1: 24000,
 		2: 16000,
 	},
+	MPEG25: {
+		0: 11025,
+		1: 12000,
+		2: 8000,
+	},
 }
 
 // Mp3 is type for MP3 audio files processing.
 type Mp3 struct {
 	*md.Track
-	release *md.Release
-	r       *binary.Reader
+	// Deep mode: every frame of the stream is checked, the results are stored in Integrity.
+	Deep      bool
+	Integrity *MP3Integrity
+	// Chapters of ID3v2 tag (audiobooks, DJ mixes).
+	Chapters []*ID3v2Chapter
+	release  *md.Release
+	r        *binary.Reader
 }
 
 // TrackMetadata gatheres metadata info for MP3 file
 func (mp3 *Mp3) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
 	mp3.release = release
 	mp3.Track = track
+	mp3.Integrity = nil
+	mp3.Chapters = nil
 	mp3.r = binary.NewReader(f)
+	var id3v2Tags map[TagKey]string
 	if ID3v2CheckSign(mp3.r) {
-		processedTags, err := ID3v2Metadata(mp3.r, mp3.Track, mp3.release)
+		tag, err := id3v2Metadata(mp3.r, mp3.Track, mp3.release)
 		if err != nil {
 			return err
 		}
-		if err = ProcessTags(processedTags, release, track); err != nil {
-			return err
-		}
+		id3v2Tags, mp3.Chapters = tag.processedTags, tag.chapters
+	}
+	pos := mp3.r.Position()
+	id3v1Tags, err := ID3v1Metadata(mp3.r, mp3.Track)
+	if err != nil && err != errID3v1NotFound {
+		return err
 	}
+	if err = ProcessTags(mergeTags(id3v1Tags, id3v2Tags), release, track); err != nil {
+		return err
+	}
+	mp3.r.SeekBytes(pos, io.SeekStart)
 	ret := mp3.headerInfo(f)
 	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
 	return ret
 }
 
 func (mp3 *Mp3) headerInfo(f io.ReadSeeker) error {
-	bitMask2 := mp3.r.ReadBEUint16()
-	switch (bitMask2 & 0xfff0) >> 4 {
-	case 0xffe:
-		return ErrMP3Ver25NotSupport
-	case 0xfff:
-	default:
-		return ErrMP3WrongSyncWord
-	}
-	mpegVersion := MPEGVersion((bitMask2 & 0x8) >> 3)
-	layer := LayerType((bitMask2 & 0x6) >> 1)
-	// bitmask & 0x1 for protection bit
-	bitMask := mp3.r.ReadUint8()
-	bitRate := byte((bitMask & 0xf0) >> 4)
-	mp3.AudioInfo.AvgBitrate = int(BitrateMap[mpegVersion][layer][bitRate])
-	mp3.AudioInfo.Samplerate = int(FrequencyMap[mpegVersion][byte((bitMask&0xc)>>2)])
+	start := mp3.r.Position()
+	end := mp3.r.SeekBytes(0, io.SeekEnd) - id3v1TrailerSize(mp3.r)
+	pos, header, err := mp3.syncFrame(start, end)
+	if err != nil {
+		return err
+	}
+	mp3.r.SeekBytes(pos, io.SeekStart)
+	mp3.AudioInfo.AvgBitrate = header.Bitrate
+	mp3.AudioInfo.Samplerate = header.Samplerate
 	mp3.AudioInfo.SampleSize = 16
-	// bitmask & 0x2 for padding bit
-	// bitmask & 0x1 for private bit
-	bitMask = mp3.r.ReadUint8()
-	if ((bitMask & 0xc0) >> 6) == 3 {
+	if header.ChannelMode == mp3ChannelModeMono {
 		mp3.AudioInfo.Channels = 1
 	} else {
 		mp3.AudioInfo.Channels = 2
 	}
-	// TODO: неверно считает для тестового примера
-	mp3.Duration = intutils.Duration(
-		float64(8*mp3.FileInfo.FileSize) / float64(mp3.AudioInfo.AvgBitrate))
+	frameSize := int64(header.Size())
+	if frameSize > end-pos {
+		frameSize = end - pos
+	}
+	frame := mp3.r.ReadBytes(frameSize)
+	vbr := mp3VBRHeader(frame, header)
+	if vbr != nil && vbr.Frames > 0 {
+		mp3.Unprocessed[mp3BitrateModeKey] = vbr.Mode
+		samples := vbr.Frames * header.Samples()
+		if vbr.LAME != nil {
+			vbr.LAME.store(mp3.Unprocessed)
+			// gapless playback: encoder delay and padding are not the part of the track
+			if n := samples - vbr.LAME.Delay - vbr.LAME.Padding; n > 0 {
+				samples = n
+			}
+		}
+		mp3.Duration = intutils.Duration(math.Round(
+			1000 * float64(samples) / float64(header.Samplerate)))
+		size := int64(vbr.Bytes)
+		if size == 0 {
+			size = end - pos
+		}
+		if mp3.Duration > 0 {
+			mp3.AudioInfo.AvgBitrate = int(math.Round(8 * float64(size) / float64(mp3.Duration)))
+		}
+	} else if header.Bitrate > 0 { // CBR stream without VBR header
+		mp3.Unprocessed[mp3BitrateModeKey] = mp3BitrateModeCBR
+		mp3.Duration = intutils.Duration(math.Round(float64(8*(end-pos)) / float64(header.Bitrate)))
+	}
+	if mp3.Deep {
+		mp3.Integrity = mp3.walkFrames(pos, end, header, vbr)
+		mp3.Duration = intutils.Duration(math.Round(
+			1000 * float64(mp3.Integrity.Samples) / float64(header.Samplerate)))
+	}
 	return nil
 }
+
+// Scans the stream for the first frame header confirmed by the consecutive frames of the same
+// stream. Leftover padding, junk and the repeated ID3v2 tags before the first frame are skipped.
+func (mp3 *Mp3) syncFrame(start, end int64) (int64, *mp3FrameHeader, error) {
+	n := end - start
+	if n > mp3SyncScanLimit+mp3SyncFrames*mp3MaxFrameSize {
+		n = mp3SyncScanLimit + mp3SyncFrames*mp3MaxFrameSize
+	}
+	if n < 4 {
+		return 0, nil, ErrMP3WrongSyncWord
+	}
+	mp3.r.SeekBytes(start, io.SeekStart)
+	d := append([]byte{}, mp3.r.ReadBytes(n)...)
+	atEnd := start+n == end
+	for i := 0; i+4 <= len(d) && i <= mp3SyncScanLimit; i++ {
+		if size := mp3ID3v2Size(d[i:]); size > 0 {
+			i += size - 1
+			continue
+		}
+		if !mpegSyncWord(d[i:]) {
+			continue
+		}
+		header, err := mp3ParseFrameHeader(d[i:])
+		if err == nil && mp3ConfirmFrames(d[i:], header, atEnd) {
+			return start + int64(i), header, nil
+		}
+	}
+	return 0, nil, ErrMP3WrongSyncWord
+}
+
+// The frame is confirmed by the headers of the consecutive frames or by the end of the stream.
+// The size of free format frames is defined by the distance to the next frame.
+func mp3ConfirmFrames(d []byte, header *mp3FrameHeader, atEnd bool) bool {
+	if header.Bitrate == 0 && !mp3FreeFormatSize(d, header) {
+		return false
+	}
+	pos, h := 0, header
+	for n := 0; n < mp3SyncFrames; n++ {
+		if pos += h.Size(); pos+4 > len(d) {
+			return atEnd && (n > 0 || pos == len(d))
+		}
+		next, err := mp3ParseFrameHeader(d[pos:])
+		if err != nil || !next.sameStream(header) {
+			return false
+		}
+		next.freeSize = header.freeSize
+		h = next
+	}
+	return true
+}
+
+// Looks for the next frame of the free format stream. Free format frames have the same
+// bitrate, so the size without padding is the same for all frames.
+func mp3FreeFormatSize(d []byte, header *mp3FrameHeader) bool {
+	for i := 4; i+4 <= len(d) && i <= mp3MaxFrameSize; i++ {
+		if !mpegSyncWord(d[i:]) {
+			continue
+		}
+		if next, err := mp3ParseFrameHeader(d[i:]); err == nil && next.sameStream(header) {
+			header.freeSize = i - header.paddingSize()
+			if header.Layer == Layer1 {
+				header.Bitrate = int(math.Round(
+					float64(header.freeSize*header.Samplerate) / 12 / 4 / 1000))
+			} else {
+				header.Bitrate = int(math.Round(
+					float64(header.freeSize*header.Samplerate) / float64(header.Samples()/8) / 1000))
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the size of ID3v2 tag at the beginning of data or 0.
+func mp3ID3v2Size(d []byte) int {
+	if len(d) < id3v2HeaderSize || string(d[:3]) != id3Sign || d[3] < 2 || d[3] > 4 ||
+		(d[6]|d[7]|d[8]|d[9])&0x80 != 0 {
+		return 0
+	}
+	size := int(parseBlockSize(d[6:10])) + id3v2HeaderSize
+	if d[5]&id3v2FlagFooter != 0 {
+		size += id3v2HeaderSize
+	}
+	return size
+}
+
+// Заголовок аудио фрейма MPEG.
+type mp3FrameHeader struct {
+	Version       MPEGVersion
+	Layer         LayerType
+	Protected     bool // CRC16 follows the header
+	Bitrate       Bitrate
+	Samplerate    SamplingRate
+	Padding       bool
+	ChannelMode   byte
+	ModeExtension byte // joint stereo bound for Layer I and II
+	freeSize      int  // size of free format frame without padding
+}
+
+// Sync scan limits
+const (
+	mp3SyncScanLimit = 1 << 20 // junk and padding before the first frame
+	mp3SyncFrames    = 3       // consecutive frames confirming the sync word
+	mp3MaxFrameSize  = 8192    // including free format frames
+)
+
+// Channel modes of the frame header
+const (
+	mp3ChannelModeJointStereo = 1
+	mp3ChannelModeMono        = 3
+)
+
+// Parses frame header: sync word(11 bits), version(2 bits), layer(2 bits), protection bit,
+// bitrate index(4 bits), samplerate index(2 bits), padding bit, private bit, channel mode(2 bits),
+// mode extension(2 bits), copyright bit, original bit, emphasis(2 bits).
+func mp3ParseFrameHeader(b []byte) (*mp3FrameHeader, error) {
+	if encb.BigEndian.Uint16(b)&0xffe0 != 0xffe0 {
+		return nil, ErrMP3WrongSyncWord
+	}
+	header := mp3FrameHeader{
+		Layer:         LayerType((b[1] & 0x6) >> 1),
+		Protected:     b[1]&0x1 == 0,
+		Padding:       b[2]&0x2 != 0,
+		ChannelMode:   (b[3] & 0xc0) >> 6,
+		ModeExtension: (b[3] & 0x30) >> 4,
+	}
+	switch (b[1] & 0x18) >> 3 {
+	case 0:
+		header.Version = MPEG25
+	case 2:
+		header.Version = MPEG2
+	case 3:
+		header.Version = MPEG1
+	default:
+		return nil, ErrMP3WrongSyncWord
+	}
+	bitrateIndex := (b[2] & 0xf0) >> 4
+	header.Bitrate = BitrateMap[header.Version][header.Layer][bitrateIndex]
+	header.Samplerate = FrequencyMap[header.Version][(b[2]&0xc)>>2]
+	if header.Layer == Reserved || bitrateIndex == 0xf || header.Samplerate == 0 {
+		return nil, ErrMP3WrongSyncWord
+	}
+	return &header, nil
+}
+
+// Frames of the same stream have the same version, layer and samplerate.
+func (header *mp3FrameHeader) sameStream(other *mp3FrameHeader) bool {
+	return header.Version == other.Version && header.Layer == other.Layer &&
+		header.Samplerate == other.Samplerate
+}
+
+func (header *mp3FrameHeader) paddingSize() int {
+	switch {
+	case !header.Padding:
+		return 0
+	case header.Layer == Layer1:
+		return 4
+	}
+	return 1
+}
+
+// Number of samples per channel in the frame.
+func (header *mp3FrameHeader) Samples() int {
+	switch {
+	case header.Layer == Layer1:
+		return 384
+	case header.Layer == Layer3 && header.Version != MPEG1:
+		return 576
+	}
+	return 1152
+}
+
+// Frame size in bytes including the header.
+func (header *mp3FrameHeader) Size() int {
+	switch {
+	case header.freeSize > 0:
+		return header.freeSize + header.paddingSize()
+	case header.Layer == Layer1:
+		return 12000*header.Bitrate/header.Samplerate*4 + header.paddingSize()
+	}
+	return header.Samples()/8*1000*header.Bitrate/header.Samplerate + header.paddingSize()
+}
+
+// Size of Layer III side information following the header and CRC.
+func (header *mp3FrameHeader) sideInfoSize() int {
+	mono := header.ChannelMode == mp3ChannelModeMono
+	if header.Version == MPEG1 {
+		if mono {
+			return 17
+		}
+		return 32
+	}
+	if mono {
+		return 9
+	}
+	return 17
+}
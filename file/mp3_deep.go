@@ -0,0 +1,171 @@
+// Покадровая проверка целостности потока MP3.
+
+package file
+
+import (
+	encb "encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MP3Integrity describes the results of the frame-by-frame check of MP3 stream.
+type MP3Integrity struct {
+	Frames           int      `json:"frames"`                  // audio frames excluding VBR header frame
+	Samples          int64    `json:"samples"`                 // per channel, without encoder delay and padding
+	HeaderFrames     int      `json:"header_frames,omitempty"` // frames declared in VBR header
+	CRCFrames        int      `json:"crc_frames,omitempty"`    // frames with checked CRC
+	BadCRCFrames     int      `json:"bad_crc_frames,omitempty"`
+	TruncatedFrames  int      `json:"truncated_frames,omitempty"`
+	MissingBytes     int64    `json:"missing_bytes,omitempty"` // of truncated frame
+	LostSyncs        int      `json:"lost_syncs,omitempty"`
+	JunkBytes        int64    `json:"junk_bytes,omitempty"` // between and after frames
+	ParameterChanges []string `json:"parameter_changes,omitempty"`
+}
+
+// OK reports whether the stream has no integrity problems.
+func (rep *MP3Integrity) OK() bool {
+	return rep.BadCRCFrames == 0 && rep.TruncatedFrames == 0 && rep.LostSyncs == 0 &&
+		rep.JunkBytes == 0 && len(rep.ParameterChanges) == 0 &&
+		(rep.HeaderFrames == 0 || rep.HeaderFrames == rep.Frames)
+}
+
+// Walks every frame from the first one. VBR header frame is not counted as audio frame.
+// The frames are resynchronized after junk; APEv2 tag at the end of the stream is not junk.
+func (mp3 *Mp3) walkFrames(pos, end int64, first *mp3FrameHeader, vbr *mp3VBRInfo) *MP3Integrity {
+	rep := MP3Integrity{}
+	prev := first
+	for pos < end {
+		mp3.r.SeekBytes(pos, io.SeekStart)
+		var header *mp3FrameHeader
+		var err error
+		if end-pos >= 4 {
+			header, err = mp3ParseFrameHeader(mp3.r.CheckBytes(4))
+		}
+		if header == nil || err != nil || !header.sameStream(prev) && !mp3.confirmed(pos, end) {
+			if end-pos >= 8 && string(mp3.r.CheckBytes(8)) == string(apeMetadataSign[:]) {
+				break
+			}
+			next, h, err := mp3.syncFrame(pos, end)
+			if err != nil {
+				rep.JunkBytes += end - pos
+				break
+			}
+			if next > pos { // not confirmed frame with changed parameters is not a sync loss
+				rep.LostSyncs++
+				rep.JunkBytes += next - pos
+			}
+			pos, header = next, h
+		}
+		if header.Bitrate == 0 {
+			header.freeSize = first.freeSize
+		}
+		if change := mp3ParameterChange(prev, header); change != "" {
+			rep.ParameterChanges = append(rep.ParameterChanges,
+				fmt.Sprintf("frame %d: %s", rep.Frames+1, change))
+		}
+		size := int64(header.Size())
+		if pos+size > end {
+			rep.TruncatedFrames++
+			rep.MissingBytes = pos + size - end
+			break
+		}
+		if crc, ok := mp3.frameCRC(pos, header); ok {
+			rep.CRCFrames++
+			if !crc {
+				rep.BadCRCFrames++
+			}
+		}
+		rep.Frames++
+		rep.Samples += int64(header.Samples())
+		prev = header
+		pos += size
+	}
+	if vbr != nil && rep.Frames > 0 {
+		rep.Frames--
+		rep.Samples -= int64(first.Samples())
+		rep.HeaderFrames = vbr.Frames
+		if vbr.LAME != nil && rep.Samples > int64(vbr.LAME.Delay+vbr.LAME.Padding) {
+			rep.Samples -= int64(vbr.LAME.Delay + vbr.LAME.Padding)
+		}
+	}
+	return &rep
+}
+
+// The frame of changed parameters is confirmed by the next frame header.
+func (mp3 *Mp3) confirmed(pos, end int64) bool {
+	n := end - pos
+	if n > 2*mp3MaxFrameSize {
+		n = 2 * mp3MaxFrameSize
+	}
+	d := append([]byte{}, mp3.r.ReadBytes(n)...)
+	mp3.r.SeekBytes(pos, io.SeekStart)
+	header, err := mp3ParseFrameHeader(d)
+	return err == nil && mp3ConfirmFrames(d, header, pos+n == end)
+}
+
+// Checks CRC of the protected frame. CRC-16 (polynomial 0x8005) covers the last two bytes of
+// the header and Layer I bit allocation or Layer III side information. Layer II is not checked.
+// Returns the check result and whether the check was done.
+func (mp3 *Mp3) frameCRC(pos int64, header *mp3FrameHeader) (bool, bool) {
+	var n int
+	switch {
+	case !header.Protected:
+		return false, false
+	case header.Layer == Layer3:
+		n = header.sideInfoSize()
+	case header.Layer == Layer1:
+		n = header.layer1AllocationSize()
+	default:
+		return false, false
+	}
+	mp3.r.SeekBytes(pos, io.SeekStart)
+	d := mp3.r.ReadBytes(int64(6 + n))
+	return mp3CRC16(mp3CRC16(0xffff, d[2:4]), d[6:]) == encb.BigEndian.Uint16(d[4:6]), true
+}
+
+// Layer I bit allocation: 4 bits per subband and channel, joint stereo subbands above
+// the bound share the allocation.
+func (header *mp3FrameHeader) layer1AllocationSize() int {
+	switch header.ChannelMode {
+	case mp3ChannelModeMono:
+		return 16
+	case mp3ChannelModeJointStereo:
+		bound := 4 * (int(header.ModeExtension) + 1)
+		return (4*(2*bound+32-bound) + 7) / 8
+	}
+	return 32
+}
+
+func mp3CRC16(crc uint16, d []byte) uint16 {
+	for _, b := range d {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Describes the change of the stream parameters except bitrate and stereo mode.
+func mp3ParameterChange(prev, header *mp3FrameHeader) string {
+	prevMono := prev.ChannelMode == mp3ChannelModeMono
+	mono := header.ChannelMode == mp3ChannelModeMono
+	if header.sameStream(prev) && prevMono == mono {
+		return ""
+	}
+	return fmt.Sprintf("%s -> %s", prev, header)
+}
+
+func (header *mp3FrameHeader) String() string {
+	version := map[MPEGVersion]string{MPEG1: "MPEG1", MPEG2: "MPEG2", MPEG25: "MPEG2.5"}
+	channels := "stereo"
+	if header.ChannelMode == mp3ChannelModeMono {
+		channels = "mono"
+	}
+	return fmt.Sprintf("%s Layer %d %d Hz %s",
+		version[header.Version], 4-int(header.Layer), header.Samplerate, channels)
+}
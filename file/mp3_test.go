@@ -0,0 +1,213 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+// MPEG1 Layer III, 128 kbps, 44100 Hz, stereo, no CRC: 417 bytes per frame.
+var mp3TestHeader = []byte{0xff, 0xfb, 0x90, 0x00}
+
+// Формирует фрейм с заданным заголовком и данными по смещению от начала фрейма.
+func mp3TestFrame(header []byte, size, offset int, data []byte) []byte {
+	frame := make([]byte, size)
+	copy(frame, header)
+	copy(frame[offset:], data)
+	return frame
+}
+
+func mp3TestTrack(t *testing.T, d []byte) *md.Track {
+	tr := md.NewTrack()
+	tr.FileInfo.FileSize = int64(len(d))
+	require.NoError(t, new(Mp3).TrackMetadata(bytes.NewReader(d), md.NewRelease(), tr))
+	return tr
+}
+
+func TestMp3Xing(t *testing.T) {
+	xing := []byte("Xing\x00\x00\x00\x03\x00\x00\x00\x00\x00\x00\x00\x00")
+	encb.BigEndian.PutUint32(xing[8:], 100)
+	encb.BigEndian.PutUint32(xing[12:], 100*417)
+	d := mp3TestFrame(mp3TestHeader, 417, 36, xing)
+	d = append(d, bytes.Repeat(mp3TestFrame(mp3TestHeader, 417, 0, nil), 2)...)
+	tr := mp3TestTrack(t, d)
+	assert.Equal(t, int64(tr.Duration), int64(2612)) // 100*1152/44100
+	assert.Equal(t, tr.AudioInfo.AvgBitrate, 128)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, tr.Unprocessed[mp3BitrateModeKey], mp3BitrateModeVBR)
+}
+
+func TestMp3VBRI(t *testing.T) {
+	vbri := make([]byte, 18)
+	copy(vbri, "VBRI\x00\x01\x04\x60\x00\x4b")
+	encb.BigEndian.PutUint32(vbri[10:], 50*417)
+	encb.BigEndian.PutUint32(vbri[14:], 50)
+	vbri = append(vbri, 0, 2, 0, 1, 0, 2, 0, 25, 0, 100, 0, 200)
+	d := mp3TestFrame(mp3TestHeader, 417, 36, vbri)
+	tr := mp3TestTrack(t, d)
+	assert.Equal(t, int64(tr.Duration), int64(1306)) // 50*1152/44100
+	assert.Equal(t, tr.Unprocessed[mp3BitrateModeKey], mp3BitrateModeVBR)
+	header, err := mp3ParseFrameHeader(d)
+	require.NoError(t, err)
+	assert.Equal(t, mp3VBRHeader(d, header).TOC, []int{100, 200})
+}
+
+func TestMp3CBR(t *testing.T) {
+	d := bytes.Repeat(mp3TestFrame(mp3TestHeader, 417, 0, nil), 10)
+	tr := mp3TestTrack(t, d)
+	assert.Equal(t, int64(tr.Duration), int64(261)) // 8*4170/128
+	assert.Equal(t, tr.AudioInfo.AvgBitrate, 128)
+	assert.Equal(t, tr.Unprocessed[mp3BitrateModeKey], mp3BitrateModeCBR)
+}
+
+func TestMp3FrameHeader(t *testing.T) {
+	header, err := mp3ParseFrameHeader(mp3TestHeader)
+	require.NoError(t, err)
+	assert.Equal(t, header.Size(), 417)
+	assert.Equal(t, header.Samples(), 1152)
+	header.Padding = true
+	assert.Equal(t, header.Size(), 418)
+	_, err = mp3ParseFrameHeader([]byte{0x49, 0x44, 0x33, 0x04})
+	assert.ErrorIs(t, err, ErrMP3WrongSyncWord)
+}
+
+func TestMp3Info(t *testing.T) {
+	d, err := os.ReadFile("../testdata/mp3/440_hz_mono.mp3")
+	require.NoError(t, err)
+	tr := mp3TestTrack(t, d)
+	assert.Equal(t, tr.Unprocessed[mp3BitrateModeKey], mp3BitrateModeCBR)
+	assert.Equal(t, int64(tr.Duration), int64(500)) // (21*1152-576-1566)/44100
+	assert.Equal(t, tr.AudioInfo.Channels, 1)
+	assert.Equal(t, tr.Unprocessed["LAME_ENCODER"], "Lavc58.35")
+	assert.Equal(t, tr.Unprocessed["ENCODER_DELAY"], "576")
+	assert.Equal(t, tr.Unprocessed["ENCODER_PADDING"], "1566")
+	assert.Equal(t, tr.Unprocessed["LAME_MUSIC_LENGTH"], "4570")
+	assert.Equal(t, tr.Unprocessed["LAME_MUSIC_CRC"], "5305")
+}
+
+func TestLAMETag(t *testing.T) {
+	d := make([]byte, lameTagSize)
+	copy(d, "LAME3.100")
+	d[9] = 0x22                                    // revision 2, ABR
+	d[10] = 195                                    // 19500 Hz
+	encb.BigEndian.PutUint32(d[11:], 1<<23/2)      // peak 0.5
+	encb.BigEndian.PutUint16(d[15:], 0x2c00|0x219) // track, automatic, -2.5 dB
+	encb.BigEndian.PutUint16(d[17:], 0x4c00|0x00a) // album, automatic, +1.0 dB
+	d[21], d[22], d[23] = 0x24, 0x00, 0x10         // delay 576, padding 16
+	tag := lameTagInfo(d)
+	require.NotNil(t, tag)
+	unprocessed := map[string]string{}
+	tag.store(unprocessed)
+	assert.Equal(t, unprocessed, map[string]string{
+		"LAME_ENCODER":          "LAME3.100",
+		"LAME_VBR_METHOD":       "ABR",
+		"LAME_LOWPASS":          "19500 Hz",
+		"REPLAYGAIN_TRACK_PEAK": "0.500000",
+		"REPLAYGAIN_TRACK_GAIN": "-2.50 dB",
+		"REPLAYGAIN_ALBUM_GAIN": "1.00 dB",
+		"ENCODER_DELAY":         "576",
+		"ENCODER_PADDING":       "16",
+		"LAME_MUSIC_CRC":        "0000",
+	})
+	assert.Nil(t, lameTagInfo(make([]byte, lameTagSize)))
+}
+
+func TestMp3Ver25(t *testing.T) {
+	header := []byte{0xff, 0xe3, 0x48, 0xc0} // MPEG2.5 Layer III, 32 kbps, 8000 Hz, mono
+	d := bytes.Repeat(mp3TestFrame(header, 288, 0, nil), 10)
+	tr := mp3TestTrack(t, d)
+	assert.Equal(t, tr.AudioInfo.Samplerate, 8000)
+	assert.Equal(t, tr.AudioInfo.AvgBitrate, 32)
+	assert.Equal(t, tr.AudioInfo.Channels, 1)
+	assert.Equal(t, int64(tr.Duration), int64(720)) // 10*576/8000
+}
+
+func TestMp3SyncScan(t *testing.T) {
+	d := append(make([]byte, 100), 0xff, 0xfb, 0x90, 0x00, 0x00) // padding and false sync word
+	d = append(d, id3v2TestTag([2]string{"TIT2", "\x03second tag"})...)
+	d = append(d, bytes.Repeat(mp3TestFrame(mp3TestHeader, 417, 0, nil), 4)...)
+	tr := mp3TestTrack(t, d)
+	assert.Equal(t, tr.AudioInfo.AvgBitrate, 128)
+	assert.Equal(t, int64(tr.Duration), int64(104)) // 8*4*417/128
+
+	_, err := mp3ParseFrameHeader([]byte{0xff, 0xeb, 0x90, 0x00}) // reserved version
+	assert.ErrorIs(t, err, ErrMP3WrongSyncWord)
+	err = new(Mp3).TrackMetadata(bytes.NewReader(make([]byte, 1000)), md.NewRelease(), md.NewTrack())
+	assert.ErrorIs(t, err, ErrMP3WrongSyncWord)
+}
+
+func TestMp3Chapters(t *testing.T) {
+	chap := append([]byte("ch1\x00"), 0, 0, 0, 0, 0, 0, 0x03, 0xe8)
+	chap = append(chap, bytes.Repeat([]byte{0xff}, 8)...)
+	chap = append(chap, id3v2TestFrame(4, "TIT2", 0, []byte("\x03intro"))...)
+	d := id3v2TestTag([2]string{"CHAP", string(chap)})
+	d = append(d, bytes.Repeat(mp3TestFrame(mp3TestHeader, 417, 0, nil), 4)...)
+	mp3 := new(Mp3)
+	require.NoError(t, mp3.TrackMetadata(bytes.NewReader(d), md.NewRelease(), md.NewTrack()))
+	require.Len(t, mp3.Chapters, 1)
+	assert.Equal(t, *mp3.Chapters[0], ID3v2Chapter{ID: "ch1", End: 1000, Title: "intro"})
+}
+
+func TestMp3FreeFormat(t *testing.T) {
+	header := []byte{0xff, 0xfb, 0x00, 0x00} // MPEG1 Layer III, free format, 44100 Hz
+	d := bytes.Repeat(mp3TestFrame(header, 500, 0, nil), 4)
+	tr := mp3TestTrack(t, d)
+	assert.Equal(t, tr.AudioInfo.AvgBitrate, 153) // 500*44100/144
+	assert.Equal(t, int64(tr.Duration), int64(105))
+}
+
+func TestMp3DeepInfo(t *testing.T) {
+	d, err := os.ReadFile("../testdata/mp3/440_hz_mono.mp3")
+	require.NoError(t, err)
+	mp3 := Mp3{Deep: true}
+	tr := md.NewTrack()
+	require.NoError(t, mp3.TrackMetadata(bytes.NewReader(d), md.NewRelease(), tr))
+	require.NotNil(t, mp3.Integrity)
+	assert.Equal(t, mp3.Integrity.Frames, 21)
+	assert.Equal(t, mp3.Integrity.HeaderFrames, 21)
+	assert.Equal(t, mp3.Integrity.Samples, int64(22050))
+	assert.True(t, mp3.Integrity.OK())
+	assert.Equal(t, int64(tr.Duration), int64(500))
+}
+
+func TestMp3DeepDamaged(t *testing.T) {
+	protected := []byte{0xff, 0xfa, 0x90, 0x00} // 128 kbps, 44100 Hz, CRC
+	good := mp3TestFrame(protected, 417, 6, []byte{1, 2, 3})
+	encb.BigEndian.PutUint16(good[4:], mp3CRC16(mp3CRC16(0xffff, good[2:4]), good[6:38]))
+	bad := append([]byte{}, good...)
+	bad[10] = 0xaa
+	header48k := []byte{0xff, 0xfb, 0x94, 0x00} // 128 kbps, 48000 Hz: 384 bytes per frame
+	d := append(append(append(good, bad...), good...), good...)
+	d = append(d, make([]byte, 10)...) // junk
+	d = append(d, bytes.Repeat(mp3TestFrame(header48k, 384, 0, nil), 3)...)
+	d = d[:len(d)-100] // truncated last frame
+
+	mp3 := Mp3{Deep: true}
+	require.NoError(t, mp3.TrackMetadata(bytes.NewReader(d), md.NewRelease(), md.NewTrack()))
+	rep := mp3.Integrity
+	require.NotNil(t, rep)
+	assert.Equal(t, rep.Frames, 6)
+	assert.Equal(t, rep.Samples, int64(6*1152))
+	assert.Equal(t, rep.CRCFrames, 4)
+	assert.Equal(t, rep.BadCRCFrames, 1)
+	assert.Equal(t, rep.LostSyncs, 1)
+	assert.Equal(t, rep.JunkBytes, int64(10))
+	assert.Equal(t, rep.TruncatedFrames, 1)
+	assert.Equal(t, rep.MissingBytes, int64(100))
+	assert.Equal(t, rep.ParameterChanges,
+		[]string{"frame 5: MPEG1 Layer 3 44100 Hz stereo -> MPEG1 Layer 3 48000 Hz stereo"})
+	assert.False(t, rep.OK())
+}
+
+func TestLAMEVBRMethodsDistinct(t *testing.T) {
+	names := map[string]byte{}
+	for method, name := range LAMEVBRMethods {
+		assert.NotContains(t, names, name, "method %d", method)
+		names[name] = method
+	}
+}
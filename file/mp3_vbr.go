@@ -0,0 +1,213 @@
+// Заголовки VBR в первом фрейме MP3: Xing/Info (LAME, FFmpeg) и VBRI (Fraunhofer).
+// Xing: https://www.codeproject.com/Articles/8295/MPEG-Audio-Frame-Header#XINGHeader
+// VBRI: https://www.codeproject.com/Articles/8295/MPEG-Audio-Frame-Header#VBRIHeader
+// LAME tag: http://gabriel.mp3-tech.org/mp3infotag.html
+
+package file
+
+import (
+	encb "encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Bitrate mode of MP3 stream in track.Unprocessed
+const (
+	mp3BitrateModeKey = "BITRATE_MODE"
+	mp3BitrateModeCBR = "CBR"
+	mp3BitrateModeVBR = "VBR"
+	mp3BitrateModeABR = "ABR"
+)
+
+// Xing header flags
+const (
+	xingFramesFlag  = 0x1
+	xingBytesFlag   = 0x2
+	xingTOCFlag     = 0x4
+	xingQualityFlag = 0x8
+)
+
+const vbriOffset = 36 // header(4) + 32
+
+const lameTagSize = 36
+
+// LAMEVBRMethods describes VBR methods of LAME tag.
+var LAMEVBRMethods = map[byte]string{
+	1: "CBR", 2: "ABR", 3: "VBR (rh)", 4: "VBR (mtrh)", 5: "VBR (mt)", 6: "VBR (method 4)",
+	8: "CBR (2 pass)", 9: "ABR (2 pass)",
+}
+
+// ReplayGain fields of LAME tag
+const (
+	lameGainTrack = 1 // radio
+	lameGainAlbum = 2 // audiophile
+)
+
+// Данные заголовка VBR.
+type mp3VBRInfo struct {
+	Mode    string
+	Frames  int // number of frames including the first one
+	Bytes   int // stream size in bytes including the first frame
+	TOC     []int
+	Quality int
+	LAME    *lameTag
+}
+
+// Данные тега LAME (расширение заголовка Xing/Info).
+type lameTag struct {
+	Encoder     string
+	VBRMethod   byte
+	Lowpass     int     // Hz
+	Peak        float64 // 0 - unknown
+	TrackGain   string
+	AlbumGain   string
+	Delay       int // samples
+	Padding     int // samples
+	MusicLength int // bytes
+	MusicCRC    uint16
+}
+
+// Looks for Xing/Info header after the side information of the first frame or VBRI header
+// at the fixed offset. Returns nil if the header is not found.
+func mp3VBRHeader(frame []byte, header *mp3FrameHeader) *mp3VBRInfo {
+	pos := 4 + header.sideInfoSize()
+	if header.Protected {
+		pos += 2
+	}
+	if len(frame) >= pos+8 {
+		switch string(frame[pos : pos+4]) {
+		case "Xing":
+			return xingHeader(frame[pos+4:], mp3BitrateModeVBR)
+		case "Info":
+			return xingHeader(frame[pos+4:], mp3BitrateModeCBR)
+		}
+	}
+	if len(frame) >= vbriOffset+26 && string(frame[vbriOffset:vbriOffset+4]) == "VBRI" {
+		return vbriHeader(frame[vbriOffset+4:])
+	}
+	return nil
+}
+
+// Xing header: flags(4), frames(4), bytes(4), TOC(100), quality(4). The fields are present
+// according to the flags.
+func xingHeader(d []byte, mode string) *mp3VBRInfo {
+	vbr := mp3VBRInfo{Mode: mode}
+	flags := encb.BigEndian.Uint32(d)
+	d = d[4:]
+	if flags&xingFramesFlag != 0 && len(d) >= 4 {
+		vbr.Frames = int(encb.BigEndian.Uint32(d))
+		d = d[4:]
+	}
+	if flags&xingBytesFlag != 0 && len(d) >= 4 {
+		vbr.Bytes = int(encb.BigEndian.Uint32(d))
+		d = d[4:]
+	}
+	if flags&xingTOCFlag != 0 && len(d) >= 100 {
+		for _, b := range d[:100] {
+			vbr.TOC = append(vbr.TOC, int(b))
+		}
+		d = d[100:]
+	}
+	if flags&xingQualityFlag != 0 && len(d) >= 4 {
+		vbr.Quality = int(encb.BigEndian.Uint32(d))
+		d = d[4:]
+	}
+	vbr.LAME = lameTagInfo(d)
+	if vbr.LAME != nil {
+		switch vbr.LAME.VBRMethod {
+		case 1, 8:
+			vbr.Mode = mp3BitrateModeCBR
+		case 2, 9:
+			vbr.Mode = mp3BitrateModeABR
+		case 3, 4, 5, 6:
+			vbr.Mode = mp3BitrateModeVBR
+		}
+	}
+	return &vbr
+}
+
+// VBRI header: version(2), delay(2), quality(2), bytes(4), frames(4), TOC entries(2),
+// TOC scale factor(2), TOC entry size(2), frames per TOC entry(2), TOC.
+func vbriHeader(d []byte) *mp3VBRInfo {
+	vbr := mp3VBRInfo{
+		Mode:    mp3BitrateModeVBR,
+		Quality: int(encb.BigEndian.Uint16(d[4:6])),
+		Bytes:   int(encb.BigEndian.Uint32(d[6:10])),
+		Frames:  int(encb.BigEndian.Uint32(d[10:14])),
+	}
+	entries := int(encb.BigEndian.Uint16(d[14:16]))
+	scale := int(encb.BigEndian.Uint16(d[16:18]))
+	entrySize := int(encb.BigEndian.Uint16(d[18:20]))
+	d = d[22:]
+	for i := 0; i < entries && entrySize >= 1 && entrySize <= 4 && len(d) >= entrySize; i++ {
+		var entry int
+		for _, b := range d[:entrySize] {
+			entry = entry<<8 | int(b)
+		}
+		vbr.TOC = append(vbr.TOC, entry*scale)
+		d = d[entrySize:]
+	}
+	return &vbr
+}
+
+// LAME tag: encoder(9), revision(4 bits) and VBR method(4 bits), lowpass(1), peak(4),
+// track gain(2), album gain(2), encoding flags(4 bits) and ATH type(4 bits), bitrate(1),
+// encoder delay(12 bits), padding(12 bits), misc(1), MP3 gain(1), preset(2), music length(4),
+// music CRC(2), tag CRC(2). Returns nil if the tag is not present.
+func lameTagInfo(d []byte) *lameTag {
+	if len(d) < lameTagSize || !id3v2IsPrintable(d[:4]) {
+		return nil
+	}
+	tag := lameTag{
+		Encoder:     strings.TrimRight(string(d[:9]), "\x00 "),
+		VBRMethod:   d[9] & 0xf,
+		Lowpass:     100 * int(d[10]),
+		Peak:        float64(encb.BigEndian.Uint32(d[11:15])) / (1 << 23),
+		Delay:       int(d[21])<<4 | int(d[22])>>4,
+		Padding:     int(d[22]&0xf)<<8 | int(d[23]),
+		MusicLength: int(encb.BigEndian.Uint32(d[28:32])),
+		MusicCRC:    encb.BigEndian.Uint16(d[32:34]),
+	}
+	for _, field := range [][]byte{d[15:17], d[17:19]} {
+		// name(3 bits), originator(3 bits), sign(1 bit), gain in 0.1 dB(9 bits)
+		v := encb.BigEndian.Uint16(field)
+		name, gain := v>>13, float64(v&0x1ff)/10
+		if v&0x200 != 0 {
+			gain = -gain
+		}
+		switch {
+		case v&0x1c00 == 0: // originator is not set
+		case name == lameGainTrack:
+			tag.TrackGain = fmt.Sprintf("%.2f dB", gain)
+		case name == lameGainAlbum:
+			tag.AlbumGain = fmt.Sprintf("%.2f dB", gain)
+		}
+	}
+	return &tag
+}
+
+// Stores LAME tag data in track.Unprocessed.
+func (tag *lameTag) store(unprocessed map[string]string) {
+	unprocessed["LAME_ENCODER"] = tag.Encoder
+	if method, ok := LAMEVBRMethods[tag.VBRMethod]; ok {
+		unprocessed["LAME_VBR_METHOD"] = method
+	}
+	if tag.Lowpass > 0 {
+		unprocessed["LAME_LOWPASS"] = fmt.Sprintf("%d Hz", tag.Lowpass)
+	}
+	if tag.Peak > 0 {
+		unprocessed["REPLAYGAIN_TRACK_PEAK"] = fmt.Sprintf("%.6f", tag.Peak)
+	}
+	if tag.TrackGain != "" {
+		unprocessed["REPLAYGAIN_TRACK_GAIN"] = tag.TrackGain
+	}
+	if tag.AlbumGain != "" {
+		unprocessed["REPLAYGAIN_ALBUM_GAIN"] = tag.AlbumGain
+	}
+	unprocessed["ENCODER_DELAY"] = fmt.Sprint(tag.Delay)
+	unprocessed["ENCODER_PADDING"] = fmt.Sprint(tag.Padding)
+	if tag.MusicLength > 0 {
+		unprocessed["LAME_MUSIC_LENGTH"] = fmt.Sprint(tag.MusicLength)
+	}
+	unprocessed["LAME_MUSIC_CRC"] = fmt.Sprintf("%04X", tag.MusicCRC)
+}
@@ -0,0 +1,439 @@
+// MP4 (M4A/M4B) processing module.
+// Specification links: ISO/IEC 14496-12 (ISO base media file format),
+// https://developer.apple.com/library/archive/documentation/QuickTime/QTFF/Metadata/Metadata.html
+// ALAC magic cookie: https://github.com/macosforge/alac/blob/master/ALACMagicCookieDescription.txt
+
+package file
+
+import (
+	encb "encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+	intutils "github.com/ytsiuryn/go-intutils"
+)
+
+const (
+	mp4FreeformAtom  = "----"
+	mp4ITunesMean    = "com.apple.iTunes"
+	mp4SoundHandler  = "soun"
+	mp4CodecKey      = "MP4_CODEC"
+	mp4DataUTF8      = 1
+	mp4DataJPEG      = 13
+	mp4DataPNG       = 14
+	mp4DataBEInteger = 21
+)
+
+// Public errors
+var (
+	ErrMP4NoSign        = errors.New("has no MP4 ftyp atom")
+	ErrMP4IncorrectAtom = errors.New("incorrect MP4 atom")
+	ErrMP4NoAudioTrack  = errors.New("has no MP4 audio track")
+)
+
+type mp4Atom struct {
+	Type string
+	Data []byte
+}
+
+// Mp4 is type for MP4 (AAC, ALAC) audio files processing.
+type Mp4 struct {
+	*md.Track
+	release *md.Release
+	r       *binary.Reader
+}
+
+// TrackMetadata gatheres metadata info for MP4 file
+func (mp4 *Mp4) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
+	mp4.release = release
+	mp4.Track = track
+	mp4.r = binary.NewReader(f)
+	moov, err := mp4.moov()
+	if err != nil {
+		return err
+	}
+	atoms, err := mp4Atoms(moov)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, trak := range mp4Children(atoms, "trak") {
+		if found, err = mp4.trak(trak.Data); err != nil {
+			return err
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return ErrMP4NoAudioTrack
+	}
+	for _, udta := range mp4Children(atoms, "udta") {
+		if err = mp4.udta(udta.Data); err != nil {
+			return err
+		}
+	}
+	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	return nil
+}
+
+// Returns data of the top level moov atom.
+func (mp4 *Mp4) moov() ([]byte, error) {
+	end := mp4.r.SeekBytes(0, io.SeekEnd)
+	mp4.r.SeekBytes(0, io.SeekStart)
+	for pos := int64(0); pos+8 <= end; {
+		size := int64(mp4.r.ReadBEUint32())
+		atomType := string(mp4.r.ReadBytes(4))
+		headerSize := int64(8)
+		if size == 1 {
+			size = int64(mp4.r.ReadBEUint64())
+			headerSize += 8
+		} else if size == 0 {
+			size = end - pos
+		}
+		if pos == 0 && atomType != "ftyp" {
+			return nil, ErrMP4NoSign
+		}
+		if size < headerSize || pos+size > end {
+			return nil, ErrMP4IncorrectAtom
+		}
+		if atomType == "moov" {
+			return append([]byte{}, mp4.r.ReadBytes(size-headerSize)...), nil
+		}
+		pos = mp4.r.SkipBytes(size - headerSize)
+	}
+	return nil, ErrMP4NoAudioTrack
+}
+
+// Processing of trak atom. Returns true if the track is an audio one.
+func (mp4 *Mp4) trak(d []byte) (bool, error) {
+	mdia, err := mp4Path(d, "mdia")
+	if err != nil || mdia == nil {
+		return false, err
+	}
+	atoms, err := mp4Atoms(mdia)
+	if err != nil {
+		return false, err
+	}
+	hdlr := mp4Child(atoms, "hdlr")
+	// version/flags(4), pre_defined(4), handler_type(4)
+	if len(hdlr) < 12 || string(hdlr[8:12]) != mp4SoundHandler {
+		return false, nil
+	}
+	if err = mp4.mdhd(mp4Child(atoms, "mdhd")); err != nil {
+		return false, err
+	}
+	stsd, err := mp4Path(mp4Child(atoms, "minf"), "stbl", "stsd")
+	if err != nil {
+		return false, err
+	}
+	if err = mp4.stsd(stsd); err != nil {
+		return false, err
+	}
+	if mp4.Duration > 0 {
+		mp4.AudioInfo.AvgBitrate = int(
+			math.Round(8 * float64(mp4.FileInfo.FileSize) / float64(mp4.Duration)))
+	}
+	return true, nil
+}
+
+// Media header: version(1), flags(3), creation time, modification time, timescale, duration.
+func (mp4 *Mp4) mdhd(d []byte) error {
+	var timescale uint32
+	var duration uint64
+	switch {
+	case len(d) >= 32 && d[0] == 1:
+		timescale = encb.BigEndian.Uint32(d[20:24])
+		duration = encb.BigEndian.Uint64(d[24:32])
+	case len(d) >= 20 && d[0] == 0:
+		timescale = encb.BigEndian.Uint32(d[12:16])
+		duration = uint64(encb.BigEndian.Uint32(d[16:20]))
+	default:
+		return ErrMP4IncorrectAtom
+	}
+	if timescale == 0 {
+		return ErrMP4IncorrectAtom
+	}
+	mp4.Duration = intutils.Duration(math.Round(1000 * float64(duration) / float64(timescale)))
+	return nil
+}
+
+// Sample description: version/flags(4), entry count(4), sample entries.
+func (mp4 *Mp4) stsd(d []byte) error {
+	if len(d) < 8 {
+		return ErrMP4IncorrectAtom
+	}
+	entries, err := mp4Atoms(d[8:])
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return ErrMP4NoAudioTrack
+	}
+	return mp4.audioSampleEntry(entries[0])
+}
+
+// Audio sample entry: reserved(6), data reference index(2), version(2), revision(2),
+// vendor(4), channels(2), sample size(2), compression id(2), packet size(2),
+// samplerate(4, 16.16), [QuickTime v1/v2 extension], child atoms.
+func (mp4 *Mp4) audioSampleEntry(entry mp4Atom) error {
+	d := entry.Data
+	if len(d) < 28 {
+		return ErrMP4IncorrectAtom
+	}
+	childPos := 28
+	switch encb.BigEndian.Uint16(d[8:10]) {
+	case 0:
+		mp4.AudioInfo.Channels = int(encb.BigEndian.Uint16(d[16:18]))
+		mp4.AudioInfo.SampleSize = int(encb.BigEndian.Uint16(d[18:20]))
+		mp4.AudioInfo.Samplerate = int(encb.BigEndian.Uint32(d[24:28]) >> 16)
+	case 1:
+		mp4.AudioInfo.Channels = int(encb.BigEndian.Uint16(d[16:18]))
+		mp4.AudioInfo.SampleSize = int(encb.BigEndian.Uint16(d[18:20]))
+		mp4.AudioInfo.Samplerate = int(encb.BigEndian.Uint32(d[24:28]) >> 16)
+		childPos += 16
+	case 2:
+		if len(d) < 64 {
+			return ErrMP4IncorrectAtom
+		}
+		mp4.AudioInfo.Samplerate = int(math.Float64frombits(encb.BigEndian.Uint64(d[32:40])))
+		mp4.AudioInfo.Channels = int(encb.BigEndian.Uint32(d[40:44]))
+		mp4.AudioInfo.SampleSize = int(encb.BigEndian.Uint32(d[48:52]))
+		childPos += 36
+	default:
+		return ErrMP4IncorrectAtom
+	}
+	switch entry.Type {
+	case "mp4a":
+		mp4.Unprocessed[mp4CodecKey] = "aac"
+	case "alac":
+		mp4.Unprocessed[mp4CodecKey] = "alac"
+		if childPos > len(d) {
+			return ErrMP4IncorrectAtom
+		}
+		children, err := mp4Atoms(d[childPos:])
+		if err != nil {
+			return err
+		}
+		mp4.alacConfig(mp4Child(children, "alac"))
+	default:
+		mp4.Unprocessed[mp4CodecKey] = entry.Type
+	}
+	return nil
+}
+
+// ALAC specific config: version/flags(4), frame length(4), compatible version(1),
+// bit depth(1), pb(1), mb(1), kb(1), channels(1), max run(2), max frame bytes(4),
+// avg bitrate(4), samplerate(4).
+func (mp4 *Mp4) alacConfig(d []byte) {
+	if len(d) < 28 {
+		return
+	}
+	mp4.AudioInfo.SampleSize = int(d[9])
+	mp4.AudioInfo.Channels = int(d[13])
+	mp4.AudioInfo.Samplerate = int(encb.BigEndian.Uint32(d[24:28]))
+}
+
+// User data processing: udta/meta/ilst.
+func (mp4 *Mp4) udta(d []byte) error {
+	meta, err := mp4Path(d, "meta")
+	if err != nil || len(meta) < 8 {
+		return err
+	}
+	// meta is a full atom in ISO files and plain one in QuickTime files
+	if string(meta[4:8]) != "hdlr" {
+		meta = meta[4:]
+	}
+	ilst, err := mp4Path(meta, "ilst")
+	if err != nil || ilst == nil {
+		return err
+	}
+	items, err := mp4Atoms(ilst)
+	if err != nil {
+		return err
+	}
+	processedTags := make(map[TagKey]string)
+	for _, item := range items {
+		if err = mp4.ilstItem(item, processedTags); err != nil {
+			return err
+		}
+	}
+	return ProcessTags(processedTags, mp4.release, mp4.Track)
+}
+
+func (mp4 *Mp4) ilstItem(item mp4Atom, processedTags map[TagKey]string) error {
+	children, err := mp4Atoms(item.Data)
+	if err != nil {
+		return err
+	}
+	name := item.Type
+	if name == mp4FreeformAtom {
+		name = mp4FreeformName(children)
+	}
+	for _, child := range children {
+		// data: type indicator(4), locale(4), value
+		if child.Type != "data" || len(child.Data) < 8 {
+			continue
+		}
+		dataType := encb.BigEndian.Uint32(child.Data[:4]) & 0xffffff
+		value := child.Data[8:]
+		switch name {
+		case "covr":
+			mp4PictMetadata(dataType, value, mp4.release)
+			continue
+		case "trkn":
+			if len(value) >= 6 {
+				n, total := encb.BigEndian.Uint16(value[2:4]), encb.BigEndian.Uint16(value[4:6])
+				processedTags[TrackNumber] = strconv.Itoa(int(n))
+				if total != 0 {
+					processedTags[TrackNumber] += "/" + strconv.Itoa(int(total))
+				}
+			}
+			continue
+		case "disk":
+			if len(value) >= 6 {
+				processedTags[DiscNumber] = strconv.Itoa(int(encb.BigEndian.Uint16(value[2:4])))
+				if total := encb.BigEndian.Uint16(value[4:6]); total != 0 {
+					processedTags[DiscTotal] = strconv.Itoa(int(total))
+				}
+			}
+			continue
+		}
+		val := mp4DataValue(dataType, value)
+		if name == "cpil" && val == "0" {
+			continue
+		}
+		if tag, ok := SchemaTagToUniKey[MP4][name]; ok {
+			processedTags[tag] = val
+		} else {
+			mp4.Unprocessed[name] = val
+		}
+	}
+	return nil
+}
+
+// Name of the freeform atom: "----:<name>" for iTunes mean and "----:<mean>:<name>" otherwise.
+func mp4FreeformName(children []mp4Atom) string {
+	var mean, name string
+	for _, child := range children {
+		if len(child.Data) < 4 {
+			continue
+		}
+		switch child.Type {
+		case "mean":
+			mean = string(child.Data[4:])
+		case "name":
+			name = string(child.Data[4:])
+		}
+	}
+	if mean == mp4ITunesMean {
+		return mp4FreeformAtom + ":" + name
+	}
+	return mp4FreeformAtom + ":" + mean + ":" + name
+}
+
+func mp4DataValue(dataType uint32, value []byte) string {
+	if dataType == mp4DataBEInteger || dataType == 0 {
+		switch len(value) {
+		case 1:
+			return strconv.Itoa(int(int8(value[0])))
+		case 2:
+			return strconv.Itoa(int(int16(encb.BigEndian.Uint16(value))))
+		case 4:
+			return strconv.Itoa(int(int32(encb.BigEndian.Uint32(value))))
+		case 8:
+			return strconv.FormatInt(int64(encb.BigEndian.Uint64(value)), 10)
+		}
+		if dataType == 0 {
+			return fmt.Sprintf("%x", value)
+		}
+	}
+	return string(value)
+}
+
+// Cover atom has no picture type, the first picture is considered as the front cover.
+func mp4PictMetadata(dataType uint32, value []byte, release *md.Release) {
+	pict := md.PictureInAudio{PictureMetadata: &md.PictureMetadata{}}
+	switch dataType {
+	case mp4DataJPEG:
+		pict.MimeType = "image/jpeg"
+	case mp4DataPNG:
+		pict.MimeType = "image/png"
+	}
+	pict.Size = uint32(len(value))
+	pict.Data = append([]byte{}, value...)
+	if p := addPicture(release, &pict); p == &pict && release.Cover() == nil {
+		pict.PictType = md.PictTypeCoverFront
+	}
+}
+
+// Splits the data into a sequence of atoms.
+func mp4Atoms(d []byte) ([]mp4Atom, error) {
+	var atoms []mp4Atom
+	for pos := uint64(0); pos+8 <= uint64(len(d)); {
+		size := uint64(encb.BigEndian.Uint32(d[pos : pos+4]))
+		atomType := mp4AtomType(d[pos+4 : pos+8])
+		headerSize := uint64(8)
+		if size == 1 {
+			if pos+16 > uint64(len(d)) {
+				return nil, ErrMP4IncorrectAtom
+			}
+			size = encb.BigEndian.Uint64(d[pos+8 : pos+16])
+			headerSize += 8
+		} else if size == 0 {
+			size = uint64(len(d)) - pos
+		}
+		if size < headerSize || pos+size > uint64(len(d)) {
+			return nil, ErrMP4IncorrectAtom
+		}
+		atoms = append(atoms, mp4Atom{atomType, d[pos+headerSize : pos+size]})
+		pos += size
+	}
+	return atoms, nil
+}
+
+// Atom type with the leading 0xA9 byte is converted to "©" symbol.
+func mp4AtomType(b []byte) string {
+	if b[0] == 0xa9 {
+		return "©" + string(b[1:])
+	}
+	return string(b)
+}
+
+// Returns the data of the nested atom by its path or nil.
+func mp4Path(d []byte, path ...string) ([]byte, error) {
+	for _, atomType := range path {
+		atoms, err := mp4Atoms(d)
+		if err != nil {
+			return nil, err
+		}
+		if d = mp4Child(atoms, atomType); d == nil {
+			return nil, nil
+		}
+	}
+	return d, nil
+}
+
+func mp4Child(atoms []mp4Atom, atomType string) []byte {
+	for _, atom := range atoms {
+		if atom.Type == atomType {
+			return atom.Data
+		}
+	}
+	return nil
+}
+
+func mp4Children(atoms []mp4Atom, atomType string) []mp4Atom {
+	var ret []mp4Atom
+	for _, atom := range atoms {
+		if atom.Type == atomType {
+			ret = append(ret, atom)
+		}
+	}
+	return ret
+}
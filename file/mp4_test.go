@@ -0,0 +1,92 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+// Размер атома MP4 включает заголовок и предшествует типу, выравнивания нет.
+func mp4TestAtom(atomType string, data ...[]byte) []byte {
+	content := bytes.Join(data, nil)
+	atom := make([]byte, 4, 8+len(content))
+	encb.BigEndian.PutUint32(atom, uint32(8+len(content)))
+	return append(append(atom, atomType...), content...)
+}
+
+func mp4TestData(dataType uint32, value []byte) []byte {
+	header := make([]byte, 8)
+	encb.BigEndian.PutUint32(header, dataType)
+	return mp4TestAtom("data", header, value)
+}
+
+func TestMp4TrackMetadata(t *testing.T) {
+	mdhd := make([]byte, 20)
+	encb.BigEndian.PutUint32(mdhd[12:], 96000)
+	encb.BigEndian.PutUint32(mdhd[16:], 192000)
+	hdlr := make([]byte, 24)
+	copy(hdlr[8:], "soun")
+	entry := make([]byte, 28)
+	encb.BigEndian.PutUint16(entry[16:], 2)
+	encb.BigEndian.PutUint16(entry[18:], 16)
+	alacCfg := make([]byte, 28)
+	alacCfg[9] = 24 // bit depth
+	alacCfg[13] = 2 // channels
+	encb.BigEndian.PutUint32(alacCfg[24:], 96000)
+	stsd := mp4TestAtom("stsd", []byte{0, 0, 0, 0, 0, 0, 0, 1},
+		mp4TestAtom("alac", entry, mp4TestAtom("alac", alacCfg)))
+	trak := mp4TestAtom("trak", mp4TestAtom("mdia",
+		mp4TestAtom("mdhd", mdhd),
+		mp4TestAtom("hdlr", hdlr),
+		mp4TestAtom("minf", mp4TestAtom("stbl", stsd))))
+	ilst := mp4TestAtom("ilst",
+		mp4TestAtom("\xa9nam", mp4TestData(mp4DataUTF8, []byte("test_track_title"))),
+		mp4TestAtom("aART", mp4TestData(mp4DataUTF8, []byte("test_performer"))),
+		mp4TestAtom("trkn", mp4TestData(0, []byte{0, 0, 0, 3, 0, 10, 0, 0})),
+		mp4TestAtom("disk", mp4TestData(0, []byte{0, 0, 0, 1, 0, 2})),
+		mp4TestAtom("cpil", mp4TestData(mp4DataBEInteger, []byte{0})),
+		mp4TestAtom("covr", mp4TestData(mp4DataPNG, []byte{0x89, 'P', 'N', 'G'})),
+		mp4TestAtom("----",
+			mp4TestAtom("mean", []byte{0, 0, 0, 0}, []byte(mp4ITunesMean)),
+			mp4TestAtom("name", []byte{0, 0, 0, 0}, []byte("CATALOGNUMBER")),
+			mp4TestData(mp4DataUTF8, []byte("test_catno"))),
+		mp4TestAtom("----",
+			mp4TestAtom("mean", []byte{0, 0, 0, 0}, []byte("org.example")),
+			mp4TestAtom("name", []byte{0, 0, 0, 0}, []byte("X")),
+			mp4TestData(mp4DataUTF8, []byte("x"))))
+	udta := mp4TestAtom("udta", mp4TestAtom("meta", []byte{0, 0, 0, 0},
+		mp4TestAtom("hdlr", make([]byte, 25)), ilst))
+	var d []byte
+	d = append(d, mp4TestAtom("ftyp", []byte("M4A "), make([]byte, 4))...)
+	d = append(d, mp4TestAtom("free")...)
+	d = append(d, mp4TestAtom("moov", trak, udta)...)
+	d = append(d, mp4TestAtom("mdat", make([]byte, 100))...)
+
+	r := md.NewRelease()
+	tr := md.NewTrack()
+	tr.FileInfo.FileSize = int64(len(d))
+	require.NoError(t, new(Mp4).TrackMetadata(bytes.NewReader(d), r, tr))
+	assert.Equal(t, int64(tr.Duration), int64(2000))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 96000)
+	assert.Equal(t, tr.AudioInfo.SampleSize, 24)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, tr.Unprocessed[mp4CodecKey], "alac")
+	assert.Equal(t, tr.Title, "test_track_title")
+	assert.Equal(t, r.ActorRoles.First(), "test_performer")
+	assert.Equal(t, tr.Position, "03")
+	assert.Equal(t, r.TotalTracks, 10)
+	assert.Equal(t, r.TotalDiscs, 2)
+	assert.Equal(t, tr.Disc().Number, 1)
+	assert.Equal(t, r.Publishing[0].Catno, "test_catno")
+	assert.Equal(t, tr.Unprocessed["----:org.example:X"], "x")
+	assert.Zero(t, r.ReleaseRepeat)
+	require.NotNil(t, r.Cover())
+	assert.Equal(t, r.Cover().MimeType, "image/png")
+
+	d = mp4TestAtom("moov", trak)
+	assert.ErrorIs(t, new(Mp4).TrackMetadata(bytes.NewReader(d), r, md.NewTrack()), ErrMP4NoSign)
+}
@@ -0,0 +1,253 @@
+// Musepack processing module.
+// Specification links: https://trac.musepack.net/musepack/wiki/SV7Specification
+// https://trac.musepack.net/musepack/wiki/SV8Specification
+
+package file
+
+import (
+	encb "encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+	intutils "github.com/ytsiuryn/go-intutils"
+)
+
+const (
+	mpcSV7Sign       = "MP+"
+	mpcSV8Sign       = "MPCK"
+	mpcProfileKey    = "MPC_PROFILE"
+	mpcFrameSamples  = 1152
+	mpcSV7HeaderSize = 25
+	// Musepack stores ReplayGain relative to this reference level.
+	mpcGainReference = 64.82
+)
+
+// Public errors
+var (
+	ErrMPCNoSign            = errors.New("has no Musepack sign mark")
+	ErrMPCVersionNotSupport = errors.New("Musepack stream version is not supported")
+	ErrMPCIncorrectPacket   = errors.New("incorrect Musepack packet")
+	ErrMPCNoStreamHeader    = errors.New("has no Musepack stream header")
+)
+
+// MPCSamplerates describes samplerate indexes of SV7 and SV8 streams.
+var MPCSamplerates = []int{44100, 48000, 37800, 32000}
+
+// MPCProfiles describes the encoder profile names by the SV7 profile index.
+// The SV8 quality is mapped to the index with the offset 5.
+var MPCProfiles = []string{
+	"n.a.", "Unstable/Experimental", "n.a.", "n.a.", "n.a.",
+	"below Telephone", "below Telephone", "Telephone", "Thumb", "Radio", "Standard",
+	"Extreme", "Insane", "BrainDead", "above BrainDead", "above BrainDead",
+}
+
+// Mpc is type for Musepack audio files processing.
+type Mpc struct {
+	*md.Track
+	release *md.Release
+	r       *binary.Reader
+}
+
+// TrackMetadata gatheres metadata info for Musepack file
+func (mpc *Mpc) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
+	mpc.release = release
+	mpc.Track = track
+	mpc.r = binary.NewReader(f)
+	var id3v2Tags map[TagKey]string
+	var err error
+	if ID3v2CheckSign(mpc.r) {
+		if id3v2Tags, err = ID3v2Metadata(mpc.r, mpc.Track, mpc.release); err != nil {
+			return err
+		}
+	}
+	switch sign := mpc.r.CheckBytes(4); {
+	case string(sign) == mpcSV8Sign:
+		err = mpc.sv8()
+	case string(sign[:3]) == mpcSV7Sign:
+		err = mpc.sv7()
+	default:
+		err = ErrMPCNoSign
+	}
+	if err != nil {
+		return err
+	}
+	if mpc.Duration > 0 {
+		mpc.AudioInfo.AvgBitrate = int(
+			math.Round(8 * float64(mpc.FileInfo.FileSize) / float64(mpc.Duration)))
+	}
+	processedTags, err := mergeTrailingTags(mpc.r, mpc.Track, mpc.release, id3v2Tags)
+	if err != nil {
+		return err
+	}
+	if err = ProcessTags(processedTags, release, track); err != nil {
+		return err
+	}
+	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	return nil
+}
+
+// SV7 header: "MP+"(3), version(1), frames count(4), flags(4), title gain/peak(4),
+// album gain/peak(4), gapless info(4), encoder version(1).
+func (mpc *Mpc) sv7() error {
+	d := mpc.r.ReadBytes(mpcSV7HeaderSize)
+	if len(d) < mpcSV7HeaderSize {
+		return ErrMPCNoSign
+	}
+	if d[3]&0xf != 7 {
+		return ErrMPCVersionNotSupport
+	}
+	frames := int64(encb.LittleEndian.Uint32(d[4:8]))
+	// IS(1), MS(1), max band(6), profile(4), link(2), samplerate(2), max level(16)
+	flags := encb.LittleEndian.Uint32(d[8:12])
+	mpc.AudioInfo.Samplerate = MPCSamplerates[(flags>>16)&0x3]
+	mpc.AudioInfo.Channels = 2
+	profile := int((flags >> 20) & 0xf)
+	mpc.Unprocessed[mpcProfileKey] = mpcProfileName(profile, float64(profile-5))
+	// title/album peak(16), title/album gain(16, signed, in 0.01 dB)
+	title, album := int16(encb.LittleEndian.Uint16(d[14:16])), int16(encb.LittleEndian.Uint16(d[18:20]))
+	mpc.setReplayGain("REPLAYGAIN_TRACK_GAIN", title, float64(title)/100)
+	mpc.setReplayGain("REPLAYGAIN_ALBUM_GAIN", album, float64(album)/100)
+	// true gapless(1), last frame samples(11), fast seeking(1), unused(19)
+	gapless := encb.LittleEndian.Uint32(d[20:24])
+	var samples int64
+	if gapless>>31 == 1 && frames > 0 {
+		samples = (frames-1)*mpcFrameSamples + int64((gapless>>20)&0x7ff)
+	} else if frames > 0 {
+		samples = frames*mpcFrameSamples - mpcFrameSamples/2
+	}
+	mpc.setDuration(samples)
+	return nil
+}
+
+// SV8 stream: "MPCK"(4), packets with key(2), size(varint, includes key and size) and data.
+// Audio packets follow header packets, so the processing stops at the first of them.
+func (mpc *Mpc) sv8() error {
+	pos := mpc.r.SkipBytes(4)
+	end := mpc.r.SeekBytes(0, io.SeekEnd)
+	var headerFound bool
+	for pos+3 <= end {
+		mpc.r.SeekBytes(pos, io.SeekStart)
+		key := string(mpc.r.ReadBytes(2))
+		size, n := mpc.readVarint(end - pos - 2)
+		if n == 0 || size < uint64(2+n) || pos+int64(size) > end {
+			return ErrMPCIncorrectPacket
+		}
+		d := mpc.r.ReadBytes(int64(size) - int64(2+n))
+		var err error
+		switch key {
+		case "SH":
+			err = mpc.streamHeader(d)
+			headerFound = err == nil
+		case "RG":
+			mpc.replayGain(d)
+		case "EI":
+			if len(d) > 0 {
+				quality := float64(d[0]>>1) / 8
+				mpc.Unprocessed[mpcProfileKey] = mpcProfileName(int(quality)+5, quality)
+			}
+		case "AP", "SE":
+			pos = end
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pos += int64(size)
+	}
+	if !headerFound {
+		return ErrMPCNoStreamHeader
+	}
+	return nil
+}
+
+// Stream header packet: CRC(4), version(1), samples count(varint), beginning silence(varint),
+// samplerate(3 bits), max used bands(5 bits), channels(4 bits), MS(1 bit), frames(3 bits).
+func (mpc *Mpc) streamHeader(d []byte) error {
+	if len(d) < 5 || d[4] != 8 {
+		return ErrMPCVersionNotSupport
+	}
+	samples, n := mpcVarint(d[5:])
+	if n == 0 || samples == 0 {
+		return ErrMPCIncorrectPacket
+	}
+	pos := 5 + n
+	silence, n := mpcVarint(d[pos:])
+	pos += n
+	if n == 0 || pos+2 > len(d) || int(d[pos]>>5) >= len(MPCSamplerates) {
+		return ErrMPCIncorrectPacket
+	}
+	mpc.AudioInfo.Samplerate = MPCSamplerates[d[pos]>>5]
+	mpc.AudioInfo.Channels = int(d[pos+1]>>4) + 1
+	if samples >= silence {
+		samples -= silence
+	}
+	mpc.setDuration(int64(samples))
+	return nil
+}
+
+// ReplayGain packet: version(1), title gain(2), title peak(2), album gain(2), album peak(2).
+// The gain is stored in 1/256 dB relative to the reference level.
+func (mpc *Mpc) replayGain(d []byte) {
+	if len(d) < 9 || d[0] != 1 {
+		return
+	}
+	title, album := int16(encb.BigEndian.Uint16(d[1:3])), int16(encb.BigEndian.Uint16(d[5:7]))
+	mpc.setReplayGain("REPLAYGAIN_TRACK_GAIN", title, mpcGainReference-float64(title)/256)
+	mpc.setReplayGain("REPLAYGAIN_ALBUM_GAIN", album, mpcGainReference-float64(album)/256)
+}
+
+// Zero stored value means the gain is not calculated.
+func (mpc *Mpc) setReplayGain(key string, stored int16, gain float64) {
+	if stored != 0 {
+		mpc.Unprocessed[key] = fmt.Sprintf("%.2f dB", gain)
+	}
+}
+
+func (mpc *Mpc) setDuration(samples int64) {
+	mpc.Duration = intutils.Duration(math.Round(
+		1000 * float64(samples) / float64(mpc.AudioInfo.Samplerate)))
+}
+
+// Reads variable length number of no more than limit bytes from the stream.
+// Returns the value and its size in bytes (0 on error).
+func (mpc *Mpc) readVarint(limit int64) (uint64, int) {
+	var ret uint64
+	for n := 1; n <= 9 && int64(n) <= limit; n++ {
+		b := mpc.r.ReadUint8()
+		ret = ret<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return ret, n
+		}
+	}
+	return 0, 0
+}
+
+// Decodes variable length number: 7 bits per byte, the high bit marks the continuation.
+// Returns the value and its size in bytes (0 on error).
+func mpcVarint(d []byte) (uint64, int) {
+	var ret uint64
+	for n, b := range d {
+		if n == 9 {
+			break
+		}
+		ret = ret<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return ret, n + 1
+		}
+	}
+	return 0, 0
+}
+
+func mpcProfileName(index int, quality float64) string {
+	if index < 0 || index >= len(MPCProfiles) {
+		return fmt.Sprintf("q=%.1f", quality)
+	}
+	if index < 5 {
+		return MPCProfiles[index]
+	}
+	return fmt.Sprintf("%s (q=%.1f)", MPCProfiles[index], quality)
+}
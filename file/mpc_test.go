@@ -0,0 +1,75 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+func mpcTestPacket(key string, data []byte) []byte {
+	// размер пакета в тестах не превышает 127 байт
+	return append([]byte{key[0], key[1], byte(len(data) + 3)}, data...)
+}
+
+func TestMpcVarint(t *testing.T) {
+	v, n := mpcVarint([]byte{0x81, 0x00, 0xff})
+	assert.Equal(t, v, uint64(128))
+	assert.Equal(t, n, 2)
+	_, n = mpcVarint([]byte{0x81})
+	assert.Zero(t, n)
+}
+
+func TestMpcSV7(t *testing.T) {
+	d := make([]byte, 28)
+	copy(d, "MP+\x17")
+	encb.LittleEndian.PutUint32(d[4:], 100)
+	encb.LittleEndian.PutUint32(d[8:], 10<<20|1<<16) // Standard, 48 kHz
+	encb.LittleEndian.PutUint32(d[12:], 0xfa1a<<16)  // title gain -15.10 dB
+	encb.LittleEndian.PutUint32(d[20:], 1<<31|576<<20)
+	d = append(d, apev2TestTag([2]string{"Title", "test_track_title"})...)
+
+	tr := md.NewTrack()
+	tr.FileInfo.FileSize = int64(len(d))
+	require.NoError(t, new(Mpc).TrackMetadata(bytes.NewReader(d), md.NewRelease(), tr))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 48000)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, int64(tr.Duration), int64(2388)) // (99*1152+576)/48000
+	assert.Equal(t, tr.Unprocessed[mpcProfileKey], "Standard (q=5.0)")
+	assert.Equal(t, tr.Unprocessed["REPLAYGAIN_TRACK_GAIN"], "-15.10 dB")
+	assert.NotContains(t, tr.Unprocessed, "REPLAYGAIN_ALBUM_GAIN")
+	assert.Equal(t, tr.Title, "test_track_title")
+}
+
+func TestMpcSV8(t *testing.T) {
+	d := []byte(mpcSV8Sign)
+	// CRC, version, samples (88200+576), silence (576), 44.1 kHz, 2 channels
+	d = append(d, mpcTestPacket("SH", []byte{0, 0, 0, 0, 8, 0x85, 0xb5, 0x48, 0x84, 0x40, 0x1f, 0x12})...)
+	d = append(d, mpcTestPacket("RG", []byte{1, 0x40, 0xd1, 0, 0, 0, 0, 0, 0})...)
+	d = append(d, mpcTestPacket("EI", []byte{0x51, 1, 16, 0})...)
+	d = append(d, mpcTestPacket("AP", make([]byte, 10))...)
+	d = append(d, mpcTestPacket("SE", nil)...)
+
+	tr := md.NewTrack()
+	require.NoError(t, new(Mpc).TrackMetadata(bytes.NewReader(d), md.NewRelease(), tr))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 44100)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, int64(tr.Duration), int64(2000))
+	assert.Equal(t, tr.Unprocessed[mpcProfileKey], "Standard (q=5.0)")
+	assert.Equal(t, tr.Unprocessed["REPLAYGAIN_TRACK_GAIN"], "0.00 dB")
+}
+
+func TestMpcSV8Malformed(t *testing.T) {
+	for _, d := range [][]byte{
+		[]byte("MPCKSH\x85"), // truncated packet size
+		append([]byte("MPCK"), mpcTestPacket("SH", []byte{0, 0, 0, 0, 8, 0x80, 0x80})...),
+		// empty sample count
+		append([]byte("MPCK"), mpcTestPacket("SH", []byte{0, 0, 0, 0, 8, 0, 0, 0x40, 0x1f})...),
+	} {
+		err := new(Mpc).TrackMetadata(bytes.NewReader(d), md.NewRelease(), md.NewTrack())
+		assert.Equal(t, err, ErrMPCIncorrectPacket)
+	}
+}
@@ -0,0 +1,178 @@
+// Ogg Vorbis processing module.
+// Specification links: https://xiph.org/ogg/doc/framing.html
+// https://xiph.org/vorbis/doc/Vorbis_I_spec.html
+
+package file
+
+import (
+	encb "encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+	intutils "github.com/ytsiuryn/go-intutils"
+)
+
+const (
+	oggSign                    = "OggS"
+	oggPageHeaderSize          = 27
+	oggMaxPageSize             = oggPageHeaderSize + 255 + 255*255
+	vorbisSign                 = "vorbis"
+	vorbisIdentificationHeader = 1
+	vorbisCommentHeader        = 3
+)
+
+// Public errors
+var (
+	ErrOggNoSign                = errors.New("has no Ogg page sign mark")
+	ErrOggIncorrectPage         = errors.New("incorrect Ogg page")
+	ErrVorbisIncorrectHeader    = errors.New("incorrect Vorbis header packet")
+	ErrOggGranuleNotFound       = errors.New("has no Ogg page with granule position")
+	errOggUnexpectedEndOfStream = errors.New("unexpected end of Ogg stream")
+)
+
+type oggPageHeader struct {
+	CapturePattern  [4]byte // "OggS"
+	Version         byte
+	HeaderType      byte // 0x1 - continued packet, 0x2 - BOS, 0x4 - EOS
+	GranulePosition int64
+	SerialNumber    uint32
+	SequenceNumber  uint32
+	Checksum        uint32
+	Segments        byte
+}
+
+// Ogg is type for Ogg Vorbis audio files processing.
+type Ogg struct {
+	*md.Track
+	release *md.Release
+	r       *binary.Reader
+}
+
+// TrackMetadata gatheres metadata info for Ogg Vorbis file
+func (ogg *Ogg) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
+	ogg.release = release
+	ogg.Track = track
+	ogg.r = binary.NewReader(f)
+	packets, serial, err := oggHeaderPackets(ogg.r, 2)
+	if err != nil {
+		return err
+	}
+	nominalBitrate, err := ogg.identificationHeader(packets[0])
+	if err != nil {
+		return err
+	}
+	if err = ogg.commentHeader(packets[1]); err != nil {
+		return err
+	}
+	granule, err := oggLastGranule(ogg.r, serial)
+	if err != nil {
+		return err
+	}
+	ogg.Duration = intutils.Duration(math.Round(
+		1000 * float64(granule) / float64(ogg.AudioInfo.Samplerate)))
+	if nominalBitrate > 0 {
+		ogg.AudioInfo.AvgBitrate = int(math.Round(float64(nominalBitrate) / 1000))
+	} else if ogg.Duration > 0 {
+		ogg.AudioInfo.AvgBitrate = int(
+			math.Round(8 * float64(ogg.FileInfo.FileSize) / float64(ogg.Duration)))
+	}
+	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	return nil
+}
+
+// Identification header: type(1), "vorbis"(6), version(4), channels(1), samplerate(4),
+// bitrate maximum(4), bitrate nominal(4), bitrate minimum(4), blocksizes(1), framing(1).
+// Returns nominal bitrate in bits per second.
+func (ogg *Ogg) identificationHeader(d []byte) (int32, error) {
+	if len(d) < 30 || d[0] != vorbisIdentificationHeader || string(d[1:7]) != vorbisSign {
+		return 0, ErrVorbisIncorrectHeader
+	}
+	ogg.AudioInfo.Channels = int(d[11])
+	ogg.AudioInfo.Samplerate = int(encb.LittleEndian.Uint32(d[12:16]))
+	if ogg.AudioInfo.Samplerate == 0 {
+		return 0, ErrVorbisIncorrectHeader
+	}
+	return int32(encb.LittleEndian.Uint32(d[20:24])), nil
+}
+
+// Comment header: type(1), "vorbis"(6), vorbis comment, framing bit(1).
+func (ogg *Ogg) commentHeader(d []byte) error {
+	if len(d) < 7 || d[0] != vorbisCommentHeader || string(d[1:7]) != vorbisSign {
+		return ErrVorbisIncorrectHeader
+	}
+	processedTags, err := VorbisCommentMetadata(d[7:], ogg.Track, ogg.release)
+	if err != nil {
+		return err
+	}
+	return ProcessTags(processedTags, ogg.release, ogg.Track)
+}
+
+// Reads first n packets of the logical stream from the current position.
+// Returns packets and the serial number of the logical stream.
+func oggHeaderPackets(r *binary.Reader, n int) ([][]byte, uint32, error) {
+	var header oggPageHeader
+	var packets [][]byte
+	var packet []byte
+	var serial uint32
+	headerSize := int64(encb.Size(header))
+	for first := true; len(packets) < n; first = false {
+		r.ReadInto(headerSize, encb.LittleEndian, &header)
+		if string(header.CapturePattern[:]) != oggSign {
+			if first {
+				return nil, 0, ErrOggNoSign
+			}
+			return nil, 0, ErrOggIncorrectPage
+		}
+		if first {
+			serial = header.SerialNumber
+		}
+		lacing := append([]byte{}, r.ReadBytes(int64(header.Segments))...)
+		var pageSize int64
+		for _, l := range lacing {
+			pageSize += int64(l)
+		}
+		if header.SerialNumber != serial { // other multiplexed logical stream
+			r.SkipBytes(pageSize)
+			continue
+		}
+		data := r.ReadBytes(pageSize)
+		if int64(len(data)) < pageSize {
+			return nil, 0, errOggUnexpectedEndOfStream
+		}
+		var pos int
+		for _, l := range lacing {
+			packet = append(packet, data[pos:pos+int(l)]...)
+			pos += int(l)
+			if l < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+	return packets[:n], serial, nil
+}
+
+// Returns granule position of the last page for the logical stream.
+func oggLastGranule(r *binary.Reader, serial uint32) (int64, error) {
+	end := r.SeekBytes(0, io.SeekEnd)
+	tail := int64(oggMaxPageSize)
+	if tail > end {
+		tail = end
+	}
+	r.SeekBytes(-tail, io.SeekEnd)
+	d := r.ReadBytes(tail)
+	for i := len(d) - oggPageHeaderSize; i >= 0; i-- {
+		if string(d[i:i+4]) != oggSign ||
+			encb.LittleEndian.Uint32(d[i+14:i+18]) != serial {
+			continue
+		}
+		// -1 means that no packets finish on the page
+		if granule := int64(encb.LittleEndian.Uint64(d[i+6 : i+14])); granule != -1 {
+			return granule, nil
+		}
+	}
+	return 0, ErrOggGranuleNotFound
+}
@@ -0,0 +1,102 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+// Формирует страницу Ogg, содержащую указанные пакеты целиком.
+func oggTestPage(serial uint32, seq uint32, granule int64, packets ...[]byte) []byte {
+	var lacing, data []byte
+	for _, p := range packets {
+		n := len(p)
+		for ; n >= 255; n -= 255 {
+			lacing = append(lacing, 255)
+		}
+		lacing = append(lacing, byte(n))
+		data = append(data, p...)
+	}
+	header := oggPageHeader{
+		CapturePattern:  [4]byte{'O', 'g', 'g', 'S'},
+		GranulePosition: granule,
+		SerialNumber:    serial,
+		SequenceNumber:  seq,
+		Segments:        byte(len(lacing)),
+	}
+	buf := new(bytes.Buffer)
+	encb.Write(buf, encb.LittleEndian, &header)
+	buf.Write(lacing)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func vorbisTestComment(fields ...string) []byte {
+	buf := new(bytes.Buffer)
+	vendor := "test_vendor"
+	encb.Write(buf, encb.LittleEndian, uint32(len(vendor)))
+	buf.WriteString(vendor)
+	encb.Write(buf, encb.LittleEndian, uint32(len(fields)))
+	for _, fld := range fields {
+		encb.Write(buf, encb.LittleEndian, uint32(len(fld)))
+		buf.WriteString(fld)
+	}
+	return buf.Bytes()
+}
+
+func TestVorbisCommentMetadata(t *testing.T) {
+	tr := md.NewTrack()
+	tags, err := VorbisCommentMetadata(
+		vorbisTestComment("title=test_track_title", "X_TAG=x"), tr, md.NewRelease())
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackTitle], "test_track_title")
+	assert.Equal(t, tr.Unprocessed["X_TAG"], "x")
+	_, err = VorbisCommentMetadata([]byte{1, 0, 0, 0}, tr, md.NewRelease())
+	assert.ErrorIs(t, err, ErrIncorrectVorbisComment)
+}
+
+func TestVorbisCommentMalformedPicture(t *testing.T) {
+	tr := md.NewTrack()
+	r := md.NewRelease()
+	tags, err := VorbisCommentMetadata(vorbisTestComment(
+		"METADATA_BLOCK_PICTURE=not base64!", "title=test_track_title"), tr, r)
+	require.NoError(t, err)
+	assert.Equal(t, tags[TrackTitle], "test_track_title")
+	assert.Empty(t, r.Pictures)
+}
+
+func TestOggTrackMetadata(t *testing.T) {
+	ident := make([]byte, 30)
+	ident[0] = vorbisIdentificationHeader
+	copy(ident[1:], vorbisSign)
+	ident[11] = 2
+	encb.LittleEndian.PutUint32(ident[12:], 44100)
+	encb.LittleEndian.PutUint32(ident[20:], 128000)
+	comment := append([]byte{vorbisCommentHeader}, vorbisSign...)
+	comment = append(comment, vorbisTestComment("TITLE=test_track_title", "TRACKNUMBER=3")...)
+	comment = append(comment, 1) // framing bit
+	var d []byte
+	d = append(d, oggTestPage(1, 0, 0, ident)...)
+	d = append(d, oggTestPage(2, 0, 0, []byte("other stream"))...)
+	d = append(d, oggTestPage(1, 1, 0, comment, make([]byte, 300))...)
+	d = append(d, oggTestPage(1, 2, 88200, make([]byte, 100))...)
+	d = append(d, oggTestPage(2, 1, 5, make([]byte, 10))...)
+
+	r := md.NewRelease()
+	tr := md.NewTrack()
+	tr.FileInfo.FileSize = int64(len(d))
+	require.NoError(t, new(Ogg).TrackMetadata(bytes.NewReader(d), r, tr))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 44100)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, tr.AudioInfo.AvgBitrate, 128)
+	assert.Equal(t, int64(tr.Duration), int64(2000))
+	assert.Equal(t, tr.Title, "test_track_title")
+	assert.Equal(t, tr.Position, "03")
+
+	assert.ErrorIs(t, new(Ogg).TrackMetadata(
+		bytes.NewReader(make([]byte, 64)), r, md.NewTrack()), ErrOggNoSign)
+}
@@ -0,0 +1,97 @@
+// Ogg Opus processing module.
+// Specification link: https://datatracker.ietf.org/doc/html/rfc7845
+
+package file
+
+import (
+	encb "encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+	intutils "github.com/ytsiuryn/go-intutils"
+)
+
+const (
+	opusHeadSign = "OpusHead"
+	opusTagsSign = "OpusTags"
+	// Opus granule position is always counted at 48 kHz.
+	opusSamplerate = 48000
+	// Unprocessed key for the output gain value of OpusHead.
+	opusOutputGainKey = "OPUS_OUTPUT_GAIN"
+)
+
+// Public errors
+var (
+	ErrOpusIncorrectHead = errors.New("incorrect OpusHead packet")
+	ErrOpusIncorrectTags = errors.New("incorrect OpusTags packet")
+)
+
+// Opus is type for Ogg Opus audio files processing.
+type Opus struct {
+	*md.Track
+	release *md.Release
+	r       *binary.Reader
+}
+
+// TrackMetadata gatheres metadata info for Opus file
+func (opus *Opus) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
+	opus.release = release
+	opus.Track = track
+	opus.r = binary.NewReader(f)
+	packets, serial, err := oggHeaderPackets(opus.r, 2)
+	if err != nil {
+		return err
+	}
+	preSkip, err := opus.head(packets[0])
+	if err != nil {
+		return err
+	}
+	if err = opus.tags(packets[1]); err != nil {
+		return err
+	}
+	granule, err := oggLastGranule(opus.r, serial)
+	if err != nil {
+		return err
+	}
+	if granule -= int64(preSkip); granule < 0 {
+		granule = 0
+	}
+	opus.Duration = intutils.Duration(math.Round(1000 * float64(granule) / opusSamplerate))
+	if opus.Duration > 0 {
+		opus.AudioInfo.AvgBitrate = int(
+			math.Round(8 * float64(opus.FileInfo.FileSize) / float64(opus.Duration)))
+	}
+	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	return nil
+}
+
+// Identification header: "OpusHead"(8), version(1), channels(1), pre-skip(2),
+// input samplerate(4), output gain(2, Q7.8 dB), mapping family(1), [mapping table].
+// Returns pre-skip value in 48 kHz samples.
+func (opus *Opus) head(d []byte) (uint16, error) {
+	if len(d) < 19 || string(d[:8]) != opusHeadSign {
+		return 0, ErrOpusIncorrectHead
+	}
+	opus.AudioInfo.Channels = int(d[9])
+	opus.AudioInfo.Samplerate = opusSamplerate
+	if gain := int16(encb.LittleEndian.Uint16(d[16:18])); gain != 0 {
+		opus.Unprocessed[opusOutputGainKey] = fmt.Sprintf("%.2f dB", float64(gain)/256)
+	}
+	return encb.LittleEndian.Uint16(d[10:12]), nil
+}
+
+// Comment header: "OpusTags"(8), vorbis comment (without framing bit).
+func (opus *Opus) tags(d []byte) error {
+	if len(d) < 8 || string(d[:8]) != opusTagsSign {
+		return ErrOpusIncorrectTags
+	}
+	processedTags, err := VorbisCommentMetadata(d[8:], opus.Track, opus.release)
+	if err != nil {
+		return err
+	}
+	return ProcessTags(processedTags, opus.release, opus.Track)
+}
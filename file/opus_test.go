@@ -0,0 +1,54 @@
+package file
+
+import (
+	"bytes"
+	"encoding/base64"
+	encb "encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+func flacTestPicture(pictType md.PictType, mime string, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	encb.Write(buf, encb.BigEndian, uint32(pictType))
+	encb.Write(buf, encb.BigEndian, uint32(len(mime)))
+	buf.WriteString(mime)
+	encb.Write(buf, encb.BigEndian, uint32(0))                  // description
+	encb.Write(buf, encb.BigEndian, [4]uint32{400, 400, 24, 0}) // width, height, depth, colors
+	encb.Write(buf, encb.BigEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestOpusTrackMetadata(t *testing.T) {
+	head := []byte(opusHeadSign)
+	head = append(head, 1, 2)       // version, channels
+	head = append(head, 0x38, 1)    // pre-skip: 312
+	head = append(head, 0, 0, 0, 0) // input samplerate
+	head = append(head, 0x80, 0xfc) // output gain: -3.5 dB
+	head = append(head, 0)          // mapping family
+	pict := base64.StdEncoding.EncodeToString(
+		flacTestPicture(md.PictTypeCoverFront, "image/jpeg", []byte{0xff, 0xd8}))
+	tags := append([]byte(opusTagsSign), vorbisTestComment(
+		"TITLE=test_track_title", "METADATA_BLOCK_PICTURE="+pict)...)
+	var d []byte
+	d = append(d, oggTestPage(7, 0, 0, head)...)
+	d = append(d, oggTestPage(7, 1, 0, tags)...)
+	d = append(d, oggTestPage(7, 2, 96312, make([]byte, 100))...)
+
+	r := md.NewRelease()
+	tr := md.NewTrack()
+	tr.FileInfo.FileSize = int64(len(d))
+	require.NoError(t, new(Opus).TrackMetadata(bytes.NewReader(d), r, tr))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 48000)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, int64(tr.Duration), int64(2000))
+	assert.Equal(t, tr.Unprocessed[opusOutputGainKey], "-3.50 dB")
+	assert.Equal(t, tr.Title, "test_track_title")
+	require.NotNil(t, r.Cover())
+	assert.Equal(t, r.Cover().MimeType, "image/jpeg")
+	assert.Equal(t, r.Cover().Data, []byte{0xff, 0xd8})
+}
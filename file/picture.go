@@ -0,0 +1,39 @@
+// Общая обработка изображений, встроенных в аудиофайлы.
+
+package file
+
+import (
+	"bytes"
+	"net/http"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+// Adds the picture to the release if the same image is not present yet. Identical images of
+// the release tracks are detected by the content: only the pictures of the same size are
+// compared, so the stored images are not rehashed on every addition. The front cover type
+// of the duplicate is kept if the release has no front cover yet. Returns the release picture.
+func addPicture(release *md.Release, pict *md.PictureInAudio) *md.PictureInAudio {
+	for _, p := range release.Pictures {
+		if len(pict.Data) == 0 {
+			if len(p.Data) == 0 && p.CoverURL != "" && p.CoverURL == pict.CoverURL {
+				return p
+			}
+		} else if len(p.Data) == len(pict.Data) && bytes.Equal(p.Data, pict.Data) {
+			if pict.PictType == md.PictTypeCoverFront && release.Cover() == nil {
+				p.PictType = md.PictTypeCoverFront
+			}
+			return p
+		}
+	}
+	release.Pictures = append(release.Pictures, pict)
+	return pict
+}
+
+// Detects MIME type of the image data. Returns empty string for unknown image format.
+func pictureMimeType(d []byte) string {
+	if mimeType := http.DetectContentType(d); bytes.HasPrefix([]byte(mimeType), []byte("image/")) {
+		return mimeType
+	}
+	return ""
+}
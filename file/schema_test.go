@@ -1,9 +1,12 @@
 package file
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
 )
 
 func TestApev2IsCoverTag(t *testing.T) {
@@ -11,9 +14,17 @@ func TestApev2IsCoverTag(t *testing.T) {
 	assert.False(t, apev2IsCoverTag("FOLDER PICTURE"))
 }
 
-// TODO: Создать минимальные тестовые данные для функции.
 func TestApev2PictMetadata(t *testing.T) {
-
+	r := md.NewRelease()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	apev2PictMetadata(append([]byte("back.png\x00"), png...), md.PictTypeCoverBack, r)
+	apev2PictMetadata(append([]byte("copy.png\x00"), png...), md.PictTypeCoverFront, r)
+	require.Len(t, r.Pictures, 1)
+	assert.Equal(t, r.Pictures[0].PictType, md.PictTypeCoverFront) // front cover is not lost
+	assert.Equal(t, r.Cover(), r.Pictures[0])
+	assert.Equal(t, r.Pictures[0].Notes, "back.png")
+	assert.Equal(t, r.Pictures[0].MimeType, "image/png")
+	assert.Equal(t, r.Pictures[0].Data, png)
 }
 
 func TestID3v2FrameSize(t *testing.T) {
@@ -23,3 +34,21 @@ func TestID3v2FrameSize(t *testing.T) {
 		assert.Contains(t, d, int(frameSize))
 	}
 }
+
+func id3v2TestSize(n int) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
+
+// Формирует тег ID3v2.4 из пар "идентификатор фрейма, данные фрейма".
+func id3v2TestTag(frames ...[2]string) []byte {
+	data := new(bytes.Buffer)
+	for _, frame := range frames {
+		data.WriteString(frame[0])
+		data.Write(id3v2TestSize(len(frame[1])))
+		data.Write([]byte{0, 0})
+		data.WriteString(frame[1])
+	}
+	tag := []byte{'I', 'D', '3', 4, 0, 0}
+	tag = append(tag, id3v2TestSize(data.Len())...)
+	return append(tag, data.Bytes()...)
+}
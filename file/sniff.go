@@ -0,0 +1,147 @@
+// Определение формата аудиофайла по сигнатуре содержимого.
+
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+const sniffSize = 64
+
+type sniffSign struct {
+	Offset    int
+	Sign      string
+	Ext       string // каноническое расширение формата в InfoLoaders
+	Container string // сигнатура контейнера в начале данных (для Offset > 0)
+}
+
+// Сигнатуры проверяются по порядку, уточняющие сигнатуры предшествуют общим.
+var sniffSigns = []sniffSign{
+	{0, "fLaC", ".flac", ""},
+	{0, "DSD ", ".dsf", ""},
+	{0, "FRM8", ".dff", ""},
+	{0, "wvpk", ".wv", ""},
+	{28, "OpusHead", ".opus", "OggS"},
+	{0, "OggS", ".ogg", ""},
+	{8, "WAVE", ".wav", "RIFF"},
+	{8, "AIFF", ".aiff", "FORM"},
+	{8, "AIFC", ".aiff", "FORM"},
+	{4, "ftyp", ".m4a", ""},
+	{0, "MAC ", ".ape", ""},
+	{0, "MPCK", ".mpc", ""},
+	{0, "MP+", ".mpc", ""},
+	{0, "TTA1", ".tta", ""},
+	{0, "\x1a\x45\xdf\xa3", ".mka", ""},
+}
+
+// Расширения, допустимые для формата наряду с каноническим (Opus в контейнере Ogg).
+var sniffCompatibleExts = map[string][]string{
+	".opus": {".ogg"},
+}
+
+// SniffReader creates TrackMetadataReader for the file by its content and extension.
+// The content signature takes precedence. If the extension does not match the content
+// the warning is returned. Files with unknown extension are not sniffed.
+func SniffReader(fn string, f io.ReadSeeker) (TrackMetadataReader, string, error) {
+	extReader := Reader(fn)
+	if extReader == nil && filepath.Ext(fn) != "" {
+		return nil, "", nil
+	}
+	ext, err := sniffExtension(f)
+	if err != nil {
+		return nil, "", err
+	}
+	if ext == "" {
+		return extReader, "", nil
+	}
+	contentReader := newReader(ext)
+	if extReader == nil || reflect.TypeOf(extReader) == reflect.TypeOf(contentReader) {
+		return contentReader, "", nil
+	}
+	for _, compatible := range sniffCompatibleExts[ext] {
+		if reflect.TypeOf(extReader) == reflect.TypeOf(InfoLoaders[compatible]) {
+			return contentReader, "", nil
+		}
+	}
+	return contentReader, fmt.Sprintf(
+		"%s: file extension does not match the content (%s)",
+		filepath.Base(fn), strings.TrimPrefix(ext, ".")), nil
+}
+
+// Returns the canonical extension of the format recognized by the content or "".
+func sniffExtension(f io.ReadSeeker) (string, error) {
+	defer f.Seek(0, io.SeekStart)
+	offset, err := id3v2Size(f)
+	if err != nil {
+		return "", err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	d := make([]byte, sniffSize)
+	n, err := io.ReadFull(f, d)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	d = d[:n]
+	for _, s := range sniffSigns {
+		if len(d) >= s.Offset+len(s.Sign) && string(d[s.Offset:s.Offset+len(s.Sign)]) == s.Sign &&
+			strings.HasPrefix(string(d), s.Container) {
+			return s.Ext, nil
+		}
+	}
+	if mpegSyncWord(d) {
+		return sniffMPEG(f, offset)
+	}
+	return "", nil
+}
+
+// MPEG audio sync word is confirmed by the headers of the consecutive frames.
+func sniffMPEG(f io.ReadSeeker, offset int64) (string, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	d := make([]byte, mp3SyncFrames*mp3MaxFrameSize+4)
+	n, err := io.ReadFull(f, d)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if n < 4 {
+		return "", nil
+	}
+	header, err := mp3ParseFrameHeader(d[:n])
+	if err == nil && mp3ConfirmFrames(d[:n], header, n < len(d)) {
+		return ".mp3", nil
+	}
+	return "", nil
+}
+
+// Returns the size of the leading ID3v2 tag including the header and footer or 0.
+func id3v2Size(f io.ReadSeeker) (int64, error) {
+	header := make([]byte, id3v2HeaderSize)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, err
+	}
+	if n < id3v2HeaderSize || !bytes.Equal(header[:3], []byte(id3Sign)) {
+		return 0, nil
+	}
+	size := int64(parseBlockSize(header[6:10])) + id3v2HeaderSize
+	if header[5]&0x10 != 0 { // footer present
+		size += id3v2HeaderSize
+	}
+	return size, nil
+}
+
+// MPEG audio frame header: sync word(11 bits), version(2 bits), layer(2 bits, not 0).
+func mpegSyncWord(d []byte) bool {
+	return len(d) >= 2 && d[0] == 0xff && d[1]&0xe0 == 0xe0 && d[1]&0x06 != 0
+}
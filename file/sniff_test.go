@@ -0,0 +1,68 @@
+package file
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffReader(t *testing.T) {
+	flac := append(id3v2TestTag([2]string{"TIT2", "\x00test_track_title"}), []byte("fLaC\x00\x00\x00\x22")...)
+
+	reader, warning, err := SniffReader("track.mp3", bytes.NewReader(flac))
+	require.NoError(t, err)
+	assert.IsType(t, reader, &Flac{})
+	assert.Equal(t, warning, "track.mp3: file extension does not match the content (flac)")
+
+	reader, warning, err = SniffReader("track", bytes.NewReader(flac))
+	require.NoError(t, err)
+	assert.IsType(t, reader, &Flac{})
+	assert.Empty(t, warning)
+	assert.NotSame(t, reader, InfoLoaders[".flac"]) // readers keep the file state
+
+	reader, warning, err = SniffReader("track.mp3", bytes.NewReader([]byte{0xff, 0xfb, 0x90, 0x64}))
+	require.NoError(t, err)
+	assert.IsType(t, reader, &Mp3{})
+	assert.Empty(t, warning)
+
+	reader, _, err = SniffReader("track.m4b", bytes.NewReader([]byte("\x00\x00\x00\x20ftypM4B ")))
+	require.NoError(t, err)
+	assert.IsType(t, reader, &Mp4{})
+
+	reader, _, err = SniffReader("cover.jpg", bytes.NewReader([]byte("fLaC")))
+	require.NoError(t, err)
+	assert.Nil(t, reader)
+
+	reader, warning, err = SniffReader("track", bytes.NewReader(
+		bytes.Repeat(mp3TestFrame(mp3TestHeader, 417, 0, nil), 3)))
+	require.NoError(t, err)
+	assert.IsType(t, reader, &Mp3{})
+	assert.Empty(t, warning)
+
+	reader, _, err = SniffReader("track", bytes.NewReader(append([]byte{0xff, 0xe3, 0x90, 0x64}, make([]byte, 2000)...)))
+	require.NoError(t, err)
+	assert.Nil(t, reader)
+}
+
+func TestSniffOpusInOgg(t *testing.T) {
+	d := append([]byte("OggS"), make([]byte, 24)...)
+	d = append(d, "OpusHead"...)
+	reader, warning, err := SniffReader("track.ogg", bytes.NewReader(d))
+	require.NoError(t, err)
+	assert.IsType(t, reader, &Opus{})
+	assert.Empty(t, warning)
+}
+
+func TestSniffMisplacedContainerSign(t *testing.T) {
+	d := []byte("JUNK\x00\x00\x00\x00WAVEfmt ")
+	reader, warning, err := SniffReader("track.mp3", bytes.NewReader(d))
+	require.NoError(t, err)
+	assert.IsType(t, reader, &Mp3{})
+	assert.Empty(t, warning)
+
+	reader, _, err = SniffReader("track", bytes.NewReader(d))
+	require.NoError(t, err)
+	assert.Nil(t, reader)
+}
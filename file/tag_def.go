@@ -17,9 +17,14 @@ const (
 	ID3v2         TagScheme = iota // Flac, Dsf, Wv
 	VorbisComment                  // Flac
 	APEv2                          // Wv
+	MP4                            // M4a (iTunes ilst)
+	RIFFInfo                       // Wav (LIST/INFO)
+	AIFFText                       // Aiff (text chunks)
+	Matroska                       // Mka (SimpleTag, track level)
+	ID3v1                          // Mp3, Wv, Ape, Mpc, Tta (trailing tag)
 )
 
-// 	Обобщенные теги для различных схем теггирования.
+// Обобщенные теги для различных схем теггирования.
 const (
 	// Titles
 	AlbumTitle TagKey = iota
@@ -257,4 +262,110 @@ var SchemaTagToUniKey = map[TagScheme]map[TagName]TagKey{
 		"COMMENT":             Comments,
 		"COPYRIGHT":           CopyrightMessage,
 	},
+	MP4: {
+		"©alb":                                   AlbumTitle,
+		"©grp":                                   ContentGroup,
+		"©nam":                                   TrackTitle,
+		"aART":                                   AlbumArtist,
+		"©ART":                                   TrackArtist,
+		"----:ARRANGER":                          Arranger,
+		"©wrt":                                   Composer,
+		"----:CONDUCTOR":                         Conductor,
+		"----:ENGINEER":                          Engineer,
+		"----:LYRICIST":                          Lyricist,
+		"----:MIXER":                             MixEngineer,
+		"----:PRODUCER":                          Producer,
+		"----:REMIXER":                           RemixedBy,
+		"----:LABEL":                             Label,
+		"disk":                                   DiscNumber,
+		"trkn":                                   TrackNumber,
+		"©day":                                   ReleaseDate,
+		"----:ORIGINALDATE":                      OriginalReleaseDate,
+		"----:ISRC":                              ISRC,
+		"----:BARCODE":                           Barcode,
+		"----:CATALOGNUMBER":                     CatalogueNumber,
+		"----:DISCOGS_RELEASE_ID":                DiscogsReleaseID,
+		"----:MusicBrainz Album Id":              MusicbrainzAlbumID,
+		"----:RUTRACKER":                         RutrackerID,
+		"cpil":                                   Compilation,
+		"----:MEDIA":                             MediaType,
+		"©gen":                                   Genre,
+		"----:MOOD":                              Mood,
+		"----:MusicBrainz Album Release Country": Country,
+		"©cmt":                                   Comments,
+		"desc":                                   Description,
+		"cprt":                                   CopyrightMessage,
+		"©lyr":                                   UnsyncedLyrics,
+		"----:LANGUAGE":                          Language,
+	},
+	RIFFInfo: {
+		"IPRD": AlbumTitle,
+		"INAM": TrackTitle,
+		"IART": TrackArtist,
+		"IMUS": Composer,
+		"IWRI": Writer,
+		"IENG": Engineer,
+		"IPRO": Producer,
+		"IPUB": Publisher,
+		"ILBL": Label,
+		"IPRT": TrackNumber,
+		"ITRK": TrackNumber,
+		"ICRD": ReleaseDate,
+		"ISRC": Source,
+		"IMED": MediaType,
+		"ISRF": SourceMedia,
+		"IGNR": Genre,
+		"ICNT": Country,
+		"ICMT": Comments,
+		"ISBJ": Description,
+		"ICOP": CopyrightMessage,
+		"ILNG": Language,
+	},
+	AIFFText: {
+		"NAME": TrackTitle,
+		"AUTH": TrackArtist,
+		"ANNO": Comments,
+		"(c) ": CopyrightMessage,
+	},
+	Matroska: {
+		"TITLE":               TrackTitle,
+		"SUBTITLE":            TrackSubtitle,
+		"ARTIST":              TrackArtist,
+		"LEAD_PERFORMER":      Soloists,
+		"ACCOMPANIMENT":       Ensemble,
+		"ARRANGER":            Arranger,
+		"WRITTEN_BY":          Writer,
+		"COMPOSER":            Composer,
+		"CONDUCTOR":           Conductor,
+		"LYRICIST":            Lyricist,
+		"SOUND_ENGINEER":      Engineer,
+		"MIXED_BY":            MixEngineer,
+		"REMIXED_BY":          RemixedBy,
+		"PRODUCER":            Producer,
+		"PUBLISHER":           Publisher,
+		"LABEL":               Label,
+		"PART_NUMBER":         TrackNumber,
+		"TOTAL_PARTS":         TrackTotal,
+		"DATE_RELEASED":       ReleaseDate,
+		"DATE_RECORDED":       RecordingDates,
+		"ISRC":                ISRC,
+		"BARCODE":             Barcode,
+		"CATALOG_NUMBER":      CatalogueNumber,
+		"ORIGINAL_MEDIA_TYPE": MediaType,
+		"GENRE":               Genre,
+		"MOOD":                Mood,
+		"COMMENT":             Comments,
+		"DESCRIPTION":         Description,
+		"COPYRIGHT":           CopyrightMessage,
+		"LYRICS":              UnsyncedLyrics,
+	},
+	ID3v1: {
+		"TITLE":   TrackTitle,
+		"ARTIST":  TrackArtist,
+		"ALBUM":   AlbumTitle,
+		"YEAR":    Year,
+		"COMMENT": Comments,
+		"TRACK":   TrackNumber,
+		"GENRE":   Genre,
+	},
 }
@@ -41,7 +41,7 @@ func ProcessTags(tags map[TagKey]TagValue, r *md.Release, t *md.Track) error {
 		case TrackArtist, InvolvedPeople:
 			parseAndAddActors(v, t)
 		case Arranger:
-			t.Record.ActorRoles.Add(v, "arranger")
+			addRecordActorRoles(v, "arranger", t)
 		case AuthorWriter, Writer:
 			t.Composition.ActorRoles.Add(v, "writer")
 		case Composer:
@@ -49,20 +49,20 @@ func ProcessTags(tags map[TagKey]TagValue, r *md.Release, t *md.Track) error {
 		case Conductor:
 			t.Record.ActorRoles.Add(v, "conductor")
 		case Engineer:
-			t.Record.ActorRoles.Add(v, "engineer")
+			addRecordActorRoles(v, "engineer", t)
 		case Ensemble:
 			t.Record.ActorRoles.Add(v, "ensemble")
 		case Lyricist:
 			t.Composition.ActorRoles.Add(v, "lyricist")
 		case MixDJ:
-			t.Record.ActorRoles.Add(v, "mix-DJ")
+			addRecordActorRoles(v, "mix-DJ", t)
 		case MixEngineer:
-			t.Record.ActorRoles.Add(v, "mix-engineer")
+			addRecordActorRoles(v, "mix-engineer", t)
 		// MusicianCredits
 		// Organisation
 		// OriginalArtist
 		case Producer:
-			t.Record.ActorRoles.Add(v, "producer")
+			addRecordActorRoles(v, "producer", t)
 		case Publisher, Label:
 			setLabels(v, r)
 		case RemixedBy:
@@ -124,7 +124,7 @@ func ProcessTags(tags map[TagKey]TagValue, r *md.Release, t *md.Track) error {
 		// TrackArtistWebPageURL
 		// --- Style ---
 		case Genre, Style:
-			t.Record.Genres = append(t.Record.Genres, v)
+			addGenres(v, t)
 		case Mood:
 			setMood(v, t)
 		// --- Miscellaneous ---
@@ -148,6 +148,17 @@ func ProcessTags(tags map[TagKey]TagValue, r *md.Release, t *md.Track) error {
 	return nil
 }
 
+// Объединяет теги различных схем. Значения последующих наборов имеют приоритет.
+func mergeTags(tagSets ...map[TagKey]TagValue) map[TagKey]TagValue {
+	ret := make(map[TagKey]TagValue)
+	for _, tags := range tagSets {
+		for k, v := range tags {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
 // ----- Compound processing -----
 
 func setDiscID(tags map[TagKey]TagValue, r *md.Release, t *md.Track) {
@@ -243,6 +254,9 @@ func setBarcode(barcode string, r *md.Release) {
 	if r.Publishing == nil {
 		r.Publishing = append(r.Publishing, &md.Publishing{})
 	}
+	if r.Publishing[0].IDs == nil {
+		r.Publishing[0].IDs = map[md.PublishingID]string{}
+	}
 	r.Publishing[0].IDs[md.Barcode] = barcode
 }
 
@@ -263,6 +277,24 @@ func parseAndAddActors(names string, track *md.Track) {
 	}
 }
 
+// Имена участников записи с одной ролью могут быть перечислены через ';'.
+func addRecordActorRoles(names, role string, t *md.Track) {
+	for _, name := range strings.Split(names, ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			t.Record.ActorRoles.Add(name, role)
+		}
+	}
+}
+
+// Несколько жанров разделяются ";" (в том числе значения многозначного фрейма ID3v2.4 TCON).
+func addGenres(genres string, t *md.Track) {
+	for _, genre := range strings.Split(genres, ";") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			t.Record.Genres = append(t.Record.Genres, genre)
+		}
+	}
+}
+
 // Обработка строк "hh:mm:ss" для записи длительности трека в миллисекундах.
 func parseAndSetTrackDuration(durationStr string, t *md.Track) {
 	t.Duration = intutils.NewDurationFromString(durationStr)
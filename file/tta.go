@@ -0,0 +1,95 @@
+// True Audio processing module.
+// Specification link: https://wiki.multimedia.cx/index.php/True_Audio
+
+package file
+
+import (
+	encb "encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+	intutils "github.com/ytsiuryn/go-intutils"
+)
+
+const (
+	ttaSign          = "TTA1"
+	ttaHeaderSize    = 22
+	ttaFormatKey     = "TTA_FORMAT"
+	ttaFormatSimple  = 1
+	ttaFormatEncrypt = 2
+)
+
+// Public errors
+var (
+	ErrTTANoSign          = errors.New("has no TTA sign mark")
+	ErrTTAIncorrectHeader = errors.New("incorrect TTA header")
+)
+
+// Tta is type for True Audio files processing.
+type Tta struct {
+	*md.Track
+	release *md.Release
+	r       *binary.Reader
+}
+
+// TrackMetadata gatheres metadata info for True Audio file
+func (tta *Tta) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
+	tta.release = release
+	tta.Track = track
+	tta.r = binary.NewReader(f)
+	var id3Tags map[TagKey]string
+	if ID3v2CheckSign(tta.r) {
+		var err error
+		if id3Tags, err = ID3v2Metadata(tta.r, tta.Track, tta.release); err != nil {
+			return err
+		}
+	}
+	if string(tta.r.CheckBytes(4)) != ttaSign {
+		return ErrTTANoSign
+	}
+	if err := tta.header(tta.r.ReadBytes(ttaHeaderSize)); err != nil {
+		return err
+	}
+	// APEv2 is the native tag format for TTA, so its values take precedence.
+	processedTags, err := mergeTrailingTags(tta.r, tta.Track, tta.release, id3Tags)
+	if err != nil {
+		return err
+	}
+	if err = ProcessTags(processedTags, release, track); err != nil {
+		return err
+	}
+	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	return nil
+}
+
+// TTA1 header: "TTA1"(4), format(2), channels(2), bits per sample(2), samplerate(4),
+// data length in samples(4), CRC32(4).
+func (tta *Tta) header(d []byte) error {
+	if len(d) < ttaHeaderSize {
+		return ErrTTAIncorrectHeader
+	}
+	format := encb.LittleEndian.Uint16(d[4:6])
+	if format != ttaFormatSimple && format != ttaFormatEncrypt {
+		return ErrTTAIncorrectHeader
+	}
+	if format == ttaFormatEncrypt {
+		tta.Unprocessed[ttaFormatKey] = "encrypted"
+	}
+	tta.AudioInfo.Channels = int(encb.LittleEndian.Uint16(d[6:8]))
+	tta.AudioInfo.SampleSize = int(encb.LittleEndian.Uint16(d[8:10]))
+	tta.AudioInfo.Samplerate = int(encb.LittleEndian.Uint32(d[10:14]))
+	if tta.AudioInfo.Samplerate == 0 {
+		return ErrTTAIncorrectHeader
+	}
+	samples := encb.LittleEndian.Uint32(d[14:18])
+	tta.Duration = intutils.Duration(math.Round(
+		1000 * float64(samples) / float64(tta.AudioInfo.Samplerate)))
+	if tta.Duration > 0 {
+		tta.AudioInfo.AvgBitrate = int(
+			math.Round(8 * float64(tta.FileInfo.FileSize) / float64(tta.Duration)))
+	}
+	return nil
+}
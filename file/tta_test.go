@@ -0,0 +1,43 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+func TestTtaTrackMetadata(t *testing.T) {
+	d := id3v2TestTag([2]string{"TIT2", "\x00id3_title"}, [2]string{"TRCK", "\x003/10"})
+	header := make([]byte, ttaHeaderSize)
+	copy(header, ttaSign)
+	encb.LittleEndian.PutUint16(header[4:], ttaFormatSimple)
+	encb.LittleEndian.PutUint16(header[6:], 2)
+	encb.LittleEndian.PutUint16(header[8:], 16)
+	encb.LittleEndian.PutUint32(header[10:], 44100)
+	encb.LittleEndian.PutUint32(header[14:], 3*44100)
+	d = append(d, header...)
+	d = append(d, make([]byte, 100)...)
+	d = append(d, apev2TestTag([2]string{"Title", "ape_title"})...)
+
+	r := md.NewRelease()
+	tr := md.NewTrack()
+	tr.FileInfo.FileSize = int64(len(d))
+	require.NoError(t, new(Tta).TrackMetadata(bytes.NewReader(d), r, tr))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 44100)
+	assert.Equal(t, tr.AudioInfo.SampleSize, 16)
+	assert.Equal(t, tr.AudioInfo.Channels, 2)
+	assert.Equal(t, int64(tr.Duration), int64(3000))
+	assert.Equal(t, tr.Title, "ape_title")
+	assert.Equal(t, tr.Position, "03")
+	assert.Equal(t, r.TotalTracks, 10)
+}
+
+func TestTtaNoSign(t *testing.T) {
+	d := append([]byte("TTA2"), make([]byte, 40)...)
+	err := new(Tta).TrackMetadata(bytes.NewReader(d), md.NewRelease(), md.NewTrack())
+	assert.ErrorIs(t, err, ErrTTANoSign)
+}
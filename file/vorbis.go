@@ -0,0 +1,76 @@
+// Vorbis comment processing module.
+// Specification link: https://xiph.org/vorbis/doc/v-comment.html
+
+package file
+
+import (
+	"encoding/base64"
+	encb "encoding/binary"
+	"errors"
+	"log"
+	"strings"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+// Изображение в формате FLAC picture block, закодированное в base64.
+const vorbisPictureTag = "METADATA_BLOCK_PICTURE"
+
+// ErrIncorrectVorbisComment ..
+var ErrIncorrectVorbisComment = errors.New("vorbis comment has illegal structure")
+
+// VorbisCommentMetadata разбирает блок Vorbis comment (без framing bit) и возвращает
+// теги, известные схеме VorbisComment. Прочие теги сохраняются в track.Unprocessed.
+func VorbisCommentMetadata(d []byte, track *md.Track, release *md.Release) (
+	map[TagKey]string, error) {
+	var frameID, val string
+	processedTags := make(map[TagKey]string)
+	if len(d) < 8 {
+		return nil, ErrIncorrectVorbisComment
+	}
+	x := uint64(encb.LittleEndian.Uint32(d[:4]))
+	pos := x + 4 // skip LibData
+	if pos+4 > uint64(len(d)) {
+		return nil, ErrIncorrectVorbisComment
+	}
+	fldCounter := encb.LittleEndian.Uint32(d[pos : pos+4])
+	pos += 4
+	for fldCounter > 0 {
+		if pos+4 > uint64(len(d)) {
+			return nil, ErrIncorrectVorbisComment
+		}
+		x = uint64(encb.LittleEndian.Uint32(d[pos : pos+4]))
+		pos += 4
+		if pos+x > uint64(len(d)) {
+			return nil, ErrIncorrectVorbisComment
+		}
+		fldData := d[pos : pos+x]
+		fields := strings.SplitN(string(fldData), "=", 2)
+		if len(fields) != 2 {
+			return nil, ErrIncorrectVorbisComment
+		}
+		frameID = strings.ToUpper(fields[0])
+		val = strings.TrimSpace(fields[1])
+		if frameID == vorbisPictureTag {
+			// malformed picture is skipped, the other comments are processed
+			if err := vorbisPictMetadata(val, release); err != nil {
+				log.Printf("%s: %s is skipped: %v", track.FileInfo.FileName, vorbisPictureTag, err)
+			}
+		} else if tag, ok := SchemaTagToUniKey[VorbisComment][frameID]; ok {
+			processedTags[tag] = val
+		} else {
+			track.Unprocessed[frameID] = val
+		}
+		fldCounter--
+		pos += x
+	}
+	return processedTags, nil
+}
+
+func vorbisPictMetadata(val string, release *md.Release) error {
+	d, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return err
+	}
+	return flacPictureMetadata(d, release)
+}
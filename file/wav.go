@@ -0,0 +1,228 @@
+// RIFF WAVE processing module.
+// Specification links: http://www-mmsp.ece.mcgill.ca/Documents/AudioFormats/WAVE/WAVE.html
+// BWF (bext chunk): https://tech.ebu.ch/docs/tech/tech3285.pdf
+
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	md "github.com/ytsiuryn/ds-audiomd"
+	binary "github.com/ytsiuryn/go-binary"
+	intutils "github.com/ytsiuryn/go-intutils"
+)
+
+const (
+	riffSign               = "RIFF"
+	waveSign               = "WAVE"
+	riffInfoSign           = "INFO"
+	waveFormatExtensible   = 0xfffe
+	waveChannelMaskKey     = "WAVE_CHANNEL_MASK"
+	waveBextDescriptionLen = 256
+)
+
+// Public errors
+var (
+	ErrWAVNoSign          = errors.New("has no RIFF WAVE sign mark")
+	ErrWAVIncorrectChunk  = errors.New("incorrect RIFF chunk")
+	ErrWAVNoFormatChunk   = errors.New("has no WAVE fmt chunk")
+	ErrWAVIncorrectFormat = errors.New("incorrect WAVE fmt chunk")
+)
+
+// WAVESpeakers describes the speaker positions of WAVE_FORMAT_EXTENSIBLE channel mask bits.
+var WAVESpeakers = []string{"FL", "FR", "FC", "LFE", "BL", "BR", "FLC", "FRC", "BC", "SL", "SR",
+	"TC", "TFL", "TFC", "TFR", "TBL", "TBC", "TBR"}
+
+type waveFormat struct {
+	FormatTag     uint16
+	Channels      uint16
+	SamplesPerSec uint32
+	BytesPerSec   uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// Broadcast Wave Format extension fields preceding UMID.
+type waveBext struct {
+	Description         [waveBextDescriptionLen]byte
+	Originator          [32]byte
+	OriginatorReference [32]byte
+	OriginationDate     [10]byte // yyyy-mm-dd
+	OriginationTime     [8]byte  // hh-mm-ss
+	TimeReference       uint64   // samples since midnight
+	Version             uint16
+}
+
+// Wav is type for RIFF WAVE audio files processing.
+type Wav struct {
+	*md.Track
+	release *md.Release
+	r       *binary.Reader
+}
+
+// TrackMetadata gatheres metadata info for WAVE file
+func (wav *Wav) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Track) error {
+	wav.release = release
+	wav.Track = track
+	wav.r = binary.NewReader(f)
+	end := wav.r.SeekBytes(0, io.SeekEnd)
+	wav.r.SeekBytes(0, io.SeekStart)
+	data := wav.r.ReadBytes(12)
+	if len(data) < 12 || string(data[:4]) != riffSign || string(data[8:12]) != waveSign {
+		return ErrWAVNoSign
+	}
+	var format *waveFormat
+	var dataSize, id3Pos int64 = 0, -1
+	infoTags := make(map[TagKey]string)
+	for pos := int64(12); pos+8 <= end; {
+		ckID := string(wav.r.ReadBytes(4))
+		ckSize := int64(wav.r.ReadLEUint32())
+		pos += 8
+		if ckID == "data" && (ckSize == 0xffffffff || pos+ckSize > end) {
+			ckSize = end - pos // streamed or truncated file
+		}
+		if pos+ckSize > end {
+			return ErrWAVIncorrectChunk
+		}
+		var err error
+		switch ckID {
+		case "fmt ":
+			format, err = wav.fmtChunk(wav.r.ReadBytes(ckSize))
+		case "data":
+			dataSize = ckSize
+		case "LIST":
+			err = wav.listChunk(wav.r.ReadBytes(ckSize), infoTags)
+		case "bext":
+			wav.bextChunk(wav.r.ReadBytes(ckSize), infoTags)
+		case "id3 ", "ID3 ":
+			id3Pos = pos
+		}
+		if err != nil {
+			return err
+		}
+		pos += ckSize + ckSize&1 // chunks are word aligned
+		wav.r.SeekBytes(pos, io.SeekStart)
+	}
+	if format == nil {
+		return ErrWAVNoFormatChunk
+	}
+	if format.BytesPerSec != 0 {
+		wav.Duration = intutils.Duration(math.Round(
+			1000 * float64(dataSize) / float64(format.BytesPerSec)))
+		wav.AudioInfo.AvgBitrate = int(math.Round(float64(format.BytesPerSec) * .008))
+	}
+	if err := ProcessTags(infoTags, release, track); err != nil {
+		return err
+	}
+	if id3Pos >= 0 {
+		wav.r.SeekBytes(id3Pos, io.SeekStart)
+		processedTags, err := ID3v2Metadata(wav.r, wav.Track, wav.release)
+		if err != nil {
+			return err
+		}
+		if err = ProcessTags(processedTags, release, track); err != nil {
+			return err
+		}
+	}
+	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
+	return nil
+}
+
+// fmt chunk: format tag(2), channels(2), samplerate(4), byterate(4), block align(2),
+// bits per sample(2), [extension size(2), valid bits(2), channel mask(4), subformat(16)].
+func (wav *Wav) fmtChunk(d []byte) (*waveFormat, error) {
+	format := waveFormat{}
+	if len(d) < encb.Size(format) {
+		return nil, ErrWAVIncorrectFormat
+	}
+	encb.Read(bytes.NewReader(d), encb.LittleEndian, &format)
+	wav.AudioInfo.Channels = int(format.Channels)
+	wav.AudioInfo.Samplerate = int(format.SamplesPerSec)
+	wav.AudioInfo.SampleSize = int(format.BitsPerSample)
+	if format.FormatTag == waveFormatExtensible && len(d) >= 24 {
+		if validBits := encb.LittleEndian.Uint16(d[18:20]); validBits != 0 {
+			wav.AudioInfo.SampleSize = int(validBits)
+		}
+		if mask := encb.LittleEndian.Uint32(d[20:24]); mask != 0 {
+			wav.Unprocessed[waveChannelMaskKey] = waveSpeakers(mask)
+		}
+	}
+	return &format, nil
+}
+
+// LIST chunk: list type(4), subchunks. Only INFO list is processed.
+func (wav *Wav) listChunk(d []byte, tags map[TagKey]string) error {
+	if len(d) < 4 || string(d[:4]) != riffInfoSign {
+		return nil
+	}
+	for pos := int64(4); pos+8 <= int64(len(d)); {
+		id := string(d[pos : pos+4])
+		size := int64(encb.LittleEndian.Uint32(d[pos+4 : pos+8]))
+		pos += 8
+		if pos+size > int64(len(d)) {
+			return ErrWAVIncorrectChunk
+		}
+		val := strings.TrimSpace(latin1String(bytes.TrimRight(d[pos:pos+size], "\x00")))
+		if tag, ok := SchemaTagToUniKey[RIFFInfo][id]; ok {
+			tags[tag] = val
+		} else {
+			wav.Unprocessed[id] = val
+		}
+		pos += size + size&1
+	}
+	return nil
+}
+
+func (wav *Wav) bextChunk(d []byte, tags map[TagKey]string) {
+	bext := waveBext{}
+	if len(d) < encb.Size(bext) {
+		return
+	}
+	encb.Read(bytes.NewReader(d), encb.LittleEndian, &bext)
+	if descr := waveBextString(bext.Description[:]); descr != "" {
+		tags[Description] = descr
+	}
+	if date := waveBextString(bext.OriginationDate[:]); date != "" {
+		tags[RecordingDates] = strings.TrimSpace(
+			date + " " + waveBextString(bext.OriginationTime[:]))
+	}
+	if originator := waveBextString(bext.Originator[:]); originator != "" {
+		wav.Unprocessed["BEXT:ORIGINATOR"] = originator
+	}
+	if ref := waveBextString(bext.OriginatorReference[:]); ref != "" {
+		wav.Unprocessed["BEXT:ORIGINATOR_REFERENCE"] = ref
+	}
+	if bext.TimeReference != 0 {
+		wav.Unprocessed["BEXT:TIME_REFERENCE"] = fmt.Sprint(bext.TimeReference)
+	}
+	// UMID(64), loudness(10) and reserved(180) fields precede the coding history.
+	if codingHistoryPos := encb.Size(bext) + 64 + 190; len(d) > codingHistoryPos {
+		if history := waveBextString(d[codingHistoryPos:]); history != "" {
+			wav.Unprocessed["BEXT:CODING_HISTORY"] = history
+		}
+	}
+}
+
+func waveBextString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(latin1String(b))
+}
+
+// Converts channel mask to the list of speaker positions, i.e. "FL,FR,LFE".
+func waveSpeakers(mask uint32) string {
+	var speakers []string
+	for i, name := range WAVESpeakers {
+		if mask&(1<<i) != 0 {
+			speakers = append(speakers, name)
+		}
+	}
+	return strings.Join(speakers, ",")
+}
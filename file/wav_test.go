@@ -0,0 +1,69 @@
+package file
+
+import (
+	"bytes"
+	encb "encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	md "github.com/ytsiuryn/ds-audiomd"
+)
+
+func riffTestChunk(id string, data ...[]byte) []byte {
+	return testChunk(encb.LittleEndian, 4, id, data...)
+}
+
+func TestWavTrackMetadata(t *testing.T) {
+	fmtData := new(bytes.Buffer)
+	encb.Write(fmtData, encb.LittleEndian, &waveFormat{
+		FormatTag:     waveFormatExtensible,
+		Channels:      6,
+		SamplesPerSec: 48000,
+		BytesPerSec:   48000 * 6 * 3,
+		BlockAlign:    18,
+		BitsPerSample: 24,
+	})
+	encb.Write(fmtData, encb.LittleEndian, []uint16{22, 20})
+	encb.Write(fmtData, encb.LittleEndian, uint32(0x3f))
+	fmtData.Write(make([]byte, 16))
+	info := []byte(riffInfoSign)
+	info = append(info, riffTestChunk("INAM", []byte("test_track_title\x00"))...)
+	info = append(info, riffTestChunk("IART", []byte("Bj\xf6rk\x00"))...)
+	info = append(info, riffTestChunk("ISFT", []byte("test_soft\x00"))...)
+	bext := new(bytes.Buffer)
+	encb.Write(bext, encb.LittleEndian, &waveBext{
+		Description:     [256]byte{'d', 'e', 's', 'c', 'r'},
+		OriginationDate: [10]byte{'2', '0', '0', '0', '-', '0', '1', '-', '0', '1'},
+	})
+	bext.Write(make([]byte, 254))
+	bext.WriteString("A=PCM,F=48000")
+
+	var d []byte
+	d = append(d, riffTestChunk("fmt ", fmtData.Bytes())...)
+	d = append(d, riffTestChunk("LIST", info)...)
+	d = append(d, riffTestChunk("bext", bext.Bytes())...)
+	d = append(d, riffTestChunk("data", make([]byte, 48000*6*3/2))...)
+	d = append(d, riffTestChunk("id3 ", id3v2TestTag([2]string{"TRCK", "\x003/10"}))...)
+	d = riffTestChunk(riffSign, append([]byte(waveSign), d...))
+
+	r := md.NewRelease()
+	tr := md.NewTrack()
+	require.NoError(t, new(Wav).TrackMetadata(bytes.NewReader(d), r, tr))
+	assert.Equal(t, tr.AudioInfo.Samplerate, 48000)
+	assert.Equal(t, tr.AudioInfo.SampleSize, 20)
+	assert.Equal(t, tr.AudioInfo.Channels, 6)
+	assert.Equal(t, tr.Unprocessed[waveChannelMaskKey], "FL,FR,FC,LFE,BL,BR")
+	assert.Equal(t, int64(tr.Duration), int64(500))
+	assert.Equal(t, tr.Title, "test_track_title")
+	assert.Equal(t, tr.Record.Actors.First(), "Björk")
+	assert.Equal(t, tr.Unprocessed["ISFT"], "test_soft")
+	assert.Equal(t, tr.Unprocessed["BEXT:CODING_HISTORY"], "A=PCM,F=48000")
+	assert.Contains(t, tr.Notes, "descr")
+	assert.Contains(t, tr.Notes, "Recording: 2000-01-01")
+	assert.Equal(t, tr.Position, "03")
+	assert.Equal(t, r.TotalTracks, 10)
+
+	assert.ErrorIs(t, new(Wav).TrackMetadata(
+		bytes.NewReader(make([]byte, 12)), r, md.NewTrack()), ErrWAVNoSign)
+}
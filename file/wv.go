@@ -96,7 +96,11 @@ func (wv *Wv) TrackMetadata(f io.ReadSeeker, release *md.Release, track *md.Trac
 	if err = wv.readAudioProps(); err != nil {
 		return err
 	}
-	if err = APEv2Metadata(wv.r, wv.Track, wv.release); err != nil {
+	processedTags, err := mergeTrailingTags(wv.r, wv.Track, wv.release, nil)
+	if err != nil {
+		return err
+	}
+	if err = ProcessTags(processedTags, release, track); err != nil {
 		return err
 	}
 	track.LinkWithDisc(release.Disc(md.DiscNumberByTrackPos(track.Position)))
@@ -74,8 +74,8 @@ class AudioMetadataReader(RPCClient):
     def __init__(self):
         super().__init__('mdreader')
 
-    def release(self, dir):
-        return self.call({"cmd": "release", "path": dir})
+    def release(self, dir, deep=False):
+        return self.call({"cmd": "release", "path": dir, "deep": deep})
 
 
 class TestMetadataReader(unittest.TestCase):
@@ -110,7 +110,7 @@ class TestMetadataReader(unittest.TestCase):
         self.assertEqual(t["record"]["genres"][0], "test_genre")
         self.assertEqual(t["title"], "test_track_title")
         basename, ext = (os.path.splitext(t["file_info"]["file_name"]))
-        if ext not in (".mp3", ".wv"):  # TODO
+        if ext != ".wv":  # TODO
             self.assertEqual(t["duration"], 500)
         self.assertEqual(basename, "440_hz_mono")
         if ext not in (".dsf", ".wv"):  # TODO
@@ -116,16 +116,57 @@ func (ar *AudioMdReader) releaseInfo(req *AudioReaderRequest) ([]byte, error) {
 	}
 
 	r := md.NewRelease()
+	var warnings []string
+	// одинаковые изображения треков хранятся однократно с именем первого файла
+	sources := map[*md.PictureInAudio]string{}
+	var integrity map[string]*afile.MP3Integrity
+	var toc map[int]*afile.FlacCueSheet
+	chapters := map[string][]*afile.ID3v2Chapter{}
 	for _, fi := range fileinfo {
+		if fi.IsDir() {
+			continue
+		}
 		fn := filepath.Join(req.Path, fi.Name())
-		track, err := ar.readTrackFile(fn, r)
+		track, reader, warning, err := ar.readTrackFile(fn, r, req.Deep)
 		if err != nil {
 			return nil, err
 		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+		switch reader := reader.(type) {
+		case *afile.Mp3:
+			if reader.Integrity != nil {
+				if integrity == nil {
+					integrity = map[string]*afile.MP3Integrity{}
+				}
+				integrity[fi.Name()] = reader.Integrity
+			}
+			if len(reader.Chapters) > 0 {
+				chapters[fi.Name()] = reader.Chapters
+			}
+		case *afile.Flac:
+			if reader.CueSheet != nil && track.Disc() != nil {
+				if toc == nil {
+					toc = map[int]*afile.FlacCueSheet{}
+				}
+				if _, ok := toc[track.Disc().Number]; !ok {
+					toc[track.Disc().Number] = reader.CueSheet
+				}
+			}
+			for _, w := range reader.Warnings {
+				warnings = append(warnings, fi.Name()+": "+w)
+			}
+		}
 		if track == nil { // not audio file
 			continue
 		}
 		r.Tracks = append(r.Tracks, track)
+		for _, pict := range r.Pictures {
+			if _, ok := sources[pict]; !ok {
+				sources[pict] = fi.Name()
+			}
+		}
 	}
 	if len(r.Tracks) == 0 {
 		return nil, err
@@ -134,28 +175,66 @@ func (ar *AudioMdReader) releaseInfo(req *AudioReaderRequest) ([]byte, error) {
 	assumption := md.NewAssumption(r)
 	assumption.Optimize()
 
-	return json.Marshal(AudioReaderResponse{Assumption: assumption})
-}
+	var pictureSources []string
+	pictureIndices := map[*md.PictureInAudio]int{}
+	for i, pict := range assumption.Pictures {
+		pictureSources = append(pictureSources, sources[pict])
+		pictureIndices[pict] = i
+	}
 
-func (ar *AudioMdReader) readTrackFile(fn string, r *md.Release) (*md.Track, error) {
-	if reader := afile.Reader(fn); reader != nil {
-		f, err := os.OpenFile(fn, os.O_RDONLY, 0444)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		fi, err := f.Stat()
-		if err != nil {
-			return nil, err
+	trackChapters := map[string][]*Chapter{}
+	for fn, fileChapters := range chapters {
+		for _, chapter := range fileChapters {
+			ch := Chapter{ID3v2Chapter: chapter}
+			if i, ok := pictureIndices[chapter.Image]; ok {
+				ch.Picture = &i
+			}
+			trackChapters[fn] = append(trackChapters[fn], &ch)
 		}
-		track := md.NewTrack()
-		track.FileInfo.FileName = fi.Name()
-		track.FileInfo.ModTime = fi.ModTime().Unix()
-		track.FileInfo.FileSize = fi.Size()
-		if err := reader.TrackMetadata(f, r, track); err != nil {
-			return nil, err
+	}
+
+	return json.Marshal(AudioReaderResponse{
+		Assumption:     assumption,
+		PictureSources: pictureSources,
+		Integrity:      integrity,
+		TOC:            toc,
+		Chapters:       trackChapters,
+		Warnings:       warnings,
+	})
+}
+
+// Формат трека определяется по содержимому файла, расширение используется для проверки.
+// Несоответствие расширения содержимому и файл MP4 без звуковой дорожки возвращаются
+// в виде предупреждения.
+// Возвращается экземпляр читателя формата с дополнительными результатами чтения файла:
+// проверкой целостности аудиопотока MP3 в режиме deep и таблицей содержания диска FLAC.
+func (ar *AudioMdReader) readTrackFile(fn string, r *md.Release, deep bool) (
+	*md.Track, afile.TrackMetadataReader, string, error) {
+	f, err := os.OpenFile(fn, os.O_RDONLY, 0444)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer f.Close()
+	reader, warning, err := afile.SniffReader(fn, f)
+	if err != nil || reader == nil {
+		return nil, nil, "", err
+	}
+	if mp3, ok := reader.(*afile.Mp3); ok {
+		mp3.Deep = deep
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	track := md.NewTrack()
+	track.FileInfo.FileName = fi.Name()
+	track.FileInfo.ModTime = fi.ModTime().Unix()
+	track.FileInfo.FileSize = fi.Size()
+	if err := reader.TrackMetadata(f, r, track); err != nil {
+		if err == afile.ErrMP4NoAudioTrack { // видеофайл без звуковой дорожки не является треком
+			return nil, nil, fi.Name() + ": " + err.Error(), nil
 		}
-		return track, nil
+		return nil, nil, "", err
 	}
-	return nil, nil
+	return track, reader, warning, nil
 }
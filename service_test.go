@@ -77,7 +77,7 @@ func checkResp(suite *suite.Suite, assumption *md.Assumption) {
 	suite.Equal(tr.Record.Genres[0], "test_genre")
 	suite.Equal(tr.Title, "test_track_title")
 	ext := filepath.Ext(tr.FileName)
-	if !collection.ContainsStr(ext, []string{".mp3", ".wv"}) { // TODO
+	if ext != ".wv" { // TODO
 		suite.Equal(int64(tr.Duration), int64(500))
 	}
 	if !collection.ContainsStr(ext, []string{".dsf", ".wv"}) { // TODO